@@ -25,6 +25,7 @@ type Event struct {
 	Player2   string    `json:"player2,omitempty"`
 	Winner    string    `json:"winner,omitempty"`
 	Duration  int       `json:"duration,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
@@ -190,6 +191,7 @@ func initAnalyticsTables(db *sql.DB) error {
 		draws INT DEFAULT 0,
 		total_moves INT DEFAULT 0,
 		avg_game_duration NUMERIC DEFAULT 0,
+		hints_used INT DEFAULT 0,
 		created_at TIMESTAMP DEFAULT NOW(),
 		updated_at TIMESTAMP DEFAULT NOW()
 	);
@@ -202,6 +204,8 @@ func initAnalyticsTables(db *sql.DB) error {
 		updated_at TIMESTAMP DEFAULT NOW()
 	);
 
+	ALTER TABLE user_metrics ADD COLUMN IF NOT EXISTS hints_used INT DEFAULT 0;
+
 	CREATE INDEX IF NOT EXISTS idx_game_events_type ON game_events(event_type);
 	CREATE INDEX IF NOT EXISTS idx_game_events_timestamp ON game_events(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_game_events_game_id ON game_events(game_id);
@@ -238,7 +242,19 @@ func (a *Analytics) processEvent(event Event) {
 		a.updatePlayerMetrics(event.Player, "move_made")
 		log.Printf("Move made in game %s by %s", event.GameID, event.Player)
 
+	case "hint_requested":
+		a.incrementMetric("total_hints")
+		a.updatePlayerMetrics(event.Player, "hint_used")
+		log.Printf("Hint given in game %s to %s", event.GameID, event.Player)
+
 	case "game_end":
+		if event.Reason == "aborted" {
+			// Nobody won or lost; keep it out of the game stats
+			a.incrementMetric("total_games_aborted")
+			log.Printf("Game aborted: %s", event.GameID)
+			break
+		}
+
 		a.incrementMetric("total_games_completed")
 		a.updateAverageGameDuration(event.Duration)
 		log.Printf("Game ended: %s (Winner: %s, Duration: %ds)", event.GameID, event.Winner, event.Duration)
@@ -401,6 +417,18 @@ func (a *Analytics) updatePlayerMetrics(username string, eventType string) {
 			log.Printf("Failed to update player move count: %v", err)
 		}
 
+	case "hint_used":
+		_, err := a.db.Exec(`
+			INSERT INTO user_metrics (username, hints_used, updated_at)
+			VALUES ($1, 1, $2)
+			ON CONFLICT (username) DO UPDATE
+			SET hints_used = user_metrics.hints_used + 1,
+			    updated_at = $2
+		`, username, time.Now())
+		if err != nil {
+			log.Printf("Failed to update player hint count: %v", err)
+		}
+
 	case "win":
 		_, err := a.db.Exec(`
 			INSERT INTO user_metrics (username, wins, updated_at)
@@ -0,0 +1,436 @@
+// Command arena plays bots against each other and estimates the Elo
+// difference between them.
+//
+//	go run ./cmd/arena -a builtin:hard -b mcts?thinkTimeMs=200 -games 500
+//
+// Bots are given as name[:level][?key=value&...], where name is a bot
+// registry entry (builtin, mcts, engine) and the query sets BotSpec
+// settings. Engine bots are configured with the same BOT_ENGINE_<LEVEL>
+// variables as the server.
+package main
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/services"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type config struct {
+	botA, botB     models.BotSpec
+	games          int
+	parallel       int
+	rules          models.Rules
+	openingPlies   int
+	seed           int64
+	moveTimeout    time.Duration
+	jsonPath       string
+	progressEvery  int
+	engineMoveTime time.Duration
+}
+
+// Report is the summary written as JSON with -json.
+type Report struct {
+	BotA       models.BotSpec `json:"botA"`
+	BotB       models.BotSpec `json:"botB"`
+	Variant    string         `json:"variant"`
+	Games      int            `json:"games"`
+	WinsA      int            `json:"winsA"`
+	Draws      int            `json:"draws"`
+	WinsB      int            `json:"winsB"`
+	ForfeitsA  int            `json:"forfeitsA"` // included in WinsB
+	ForfeitsB  int            `json:"forfeitsB"` // included in WinsA
+	ScoreA     float64        `json:"scoreA"`    // fraction of points won by A
+	EloDiff    eloValue       `json:"eloDiff"`   // A minus B
+	EloLow     eloValue       `json:"eloLow"`    // 95% confidence interval
+	EloHigh    eloValue       `json:"eloHigh"`
+	AvgMoveA   float64        `json:"avgMoveMsA"`
+	AvgMoveB   float64        `json:"avgMoveMsB"`
+	StartedAt  time.Time      `json:"startedAt"`
+	DurationMs int64          `json:"durationMs"`
+}
+
+// eloValue is an Elo difference. A bot that won or lost every game has an
+// infinite difference, which is written to JSON as "+inf" or "-inf".
+type eloValue float64
+
+func (v eloValue) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(v), 0) {
+		return json.Marshal(v.String())
+	}
+	return json.Marshal(float64(v))
+}
+
+func (v eloValue) String() string {
+	switch {
+	case math.IsInf(float64(v), 1):
+		return "+inf"
+	case math.IsInf(float64(v), -1):
+		return "-inf"
+	}
+	return fmt.Sprintf("%+.0f", float64(v))
+}
+
+// gameResult is one game from A's point of view.
+type gameResult struct {
+	score      float64 // 1 win, 0.5 draw, 0 loss
+	forfeit    int     // 1 if A forfeited, 2 if B did
+	movesA     int
+	movesB     int
+	thinkTimeA time.Duration
+	thinkTimeB time.Duration
+}
+
+func main() {
+	cfg := parseFlags()
+
+	registry := services.NewBotRegistry()
+	services.RegisterDefaultBots(registry, services.LoadEnginesFromEnv(), cfg.engineMoveTime)
+
+	report := run(cfg, registry)
+	printReport(report)
+
+	if cfg.jsonPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal("Failed to encode report:", err)
+		}
+		if err := os.WriteFile(cfg.jsonPath, data, 0o644); err != nil {
+			log.Fatal("Failed to write report:", err)
+		}
+	}
+}
+
+func parseFlags() config {
+	var cfg config
+	var botA, botB, variant string
+
+	flag.StringVar(&botA, "a", "builtin:hard", "first bot, as name[:level][?key=value&...]")
+	flag.StringVar(&botB, "b", "builtin:medium", "second bot")
+	flag.IntVar(&cfg.games, "games", 1000, "number of games to play")
+	flag.IntVar(&cfg.parallel, "parallel", runtime.NumCPU(), "games to play at once")
+	flag.StringVar(&variant, "variant", "standard", "board variant")
+	flag.IntVar(&cfg.openingPlies, "random-opening", 0, "random moves played before the bots take over")
+	flag.Int64Var(&cfg.seed, "seed", time.Now().UnixNano(), "seed for random openings")
+	flag.DurationVar(&cfg.moveTimeout, "move-timeout", 10*time.Second, "time after which a bot forfeits")
+	flag.StringVar(&cfg.jsonPath, "json", "", "write the report as JSON to this file")
+	flag.IntVar(&cfg.progressEvery, "progress", 100, "log progress every N games, 0 to disable")
+	flag.DurationVar(&cfg.engineMoveTime, "engine-movetime", services.EngineMoveTimeFromEnv(), "default think time for engine bots")
+	flag.Parse()
+
+	var err error
+	if cfg.botA, err = parseSpec(botA); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.botB, err = parseSpec(botB); err != nil {
+		log.Fatal(err)
+	}
+
+	rules, ok := models.RulesForVariant(variant)
+	if !ok {
+		log.Fatalf("Unknown variant %q", variant)
+	}
+	cfg.rules = rules
+
+	if cfg.games < 1 || cfg.parallel < 1 {
+		log.Fatal("-games and -parallel must be positive")
+	}
+
+	return cfg
+}
+
+// parseSpec reads name[:level][?key=value&...].
+func parseSpec(s string) (models.BotSpec, error) {
+	var spec models.BotSpec
+
+	base, query, _ := strings.Cut(s, "?")
+	name, level, _ := strings.Cut(base, ":")
+	spec.Name = name
+
+	botLevel, ok := models.ParseBotLevel(level)
+	if !ok {
+		return spec, fmt.Errorf("unknown bot level %q in %q", level, s)
+	}
+	spec.Level = botLevel
+
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return spec, fmt.Errorf("bad settings in %q: %v", s, err)
+		}
+		spec.Settings = make(map[string]string)
+		for key := range values {
+			spec.Settings[key] = values.Get(key)
+		}
+	}
+
+	return spec, nil
+}
+
+// run plays the games in pairs that share an opening, with A moving first
+// in one and B in the other.
+func run(cfg config, registry *services.BotRegistry) Report {
+	started := time.Now()
+	rng := rand.New(rand.NewSource(cfg.seed))
+
+	openings := make([][]int, (cfg.games+1)/2)
+	for i := range openings {
+		openings[i] = randomOpening(cfg.rules, cfg.openingPlies, rng)
+	}
+
+	jobs := make(chan int)
+	results := make(chan gameResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- playGame(cfg, registry, openings[i/2], i%2 == 0)
+			}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < cfg.games; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	report := Report{
+		BotA:      cfg.botA,
+		BotB:      cfg.botB,
+		Variant:   cfg.rules.Variant,
+		StartedAt: started,
+	}
+	var scores []float64
+	var movesA, movesB int
+	var thinkA, thinkB time.Duration
+
+	for r := range results {
+		scores = append(scores, r.score)
+		switch r.score {
+		case 1:
+			report.WinsA++
+		case 0:
+			report.WinsB++
+		default:
+			report.Draws++
+		}
+		switch r.forfeit {
+		case 1:
+			report.ForfeitsA++
+		case 2:
+			report.ForfeitsB++
+		}
+		movesA += r.movesA
+		movesB += r.movesB
+		thinkA += r.thinkTimeA
+		thinkB += r.thinkTimeB
+
+		if cfg.progressEvery > 0 && len(scores)%cfg.progressEvery == 0 {
+			log.Printf("%d/%d games: +%d =%d -%d", len(scores), cfg.games, report.WinsA, report.Draws, report.WinsB)
+		}
+	}
+
+	report.Games = len(scores)
+	report.ScoreA, report.EloDiff, report.EloLow, report.EloHigh = eloEstimate(scores)
+	if movesA > 0 {
+		report.AvgMoveA = float64(thinkA.Microseconds()) / 1000 / float64(movesA)
+	}
+	if movesB > 0 {
+		report.AvgMoveB = float64(thinkB.Microseconds()) / 1000 / float64(movesB)
+	}
+	report.DurationMs = time.Since(started).Milliseconds()
+
+	return report
+}
+
+// randomOpening picks up to plies random columns that don't end the game.
+func randomOpening(rules models.Rules, plies int, rng *rand.Rand) []int {
+	game := models.NewGame(&models.Player{}, rules)
+	var opening []int
+
+	for len(opening) < plies {
+		playerNum := 1 + len(opening)%2
+
+		var quiet []int
+		for col := 0; col < rules.Columns; col++ {
+			if isQuietMove(game, col, playerNum) {
+				quiet = append(quiet, col)
+			}
+		}
+		if len(quiet) == 0 {
+			break
+		}
+
+		col := quiet[rng.Intn(len(quiet))]
+		services.MakeMove(game, col, playerNum)
+		opening = append(opening, col)
+	}
+
+	return opening
+}
+
+// isQuietMove reports whether a move is legal and neither wins nor fills
+// the board.
+func isQuietMove(game *models.Game, col, playerNum int) bool {
+	if !services.IsValidMove(game, col) {
+		return false
+	}
+	trial := services.CloneGame(game)
+	services.MakeMove(trial, col, playerNum)
+	won, _, _ := services.CheckWinner(trial)
+	return !won && !services.IsBoardFull(trial)
+}
+
+// playGame plays one game. aFirst decides whether A is player 1.
+func playGame(cfg config, registry *services.BotRegistry, opening []int, aFirst bool) gameResult {
+	playerA := &models.Player{ID: "a", Username: "A", IsBot: true, Bot: &cfg.botA}
+	playerB := &models.Player{ID: "b", Username: "B", IsBot: true, Bot: &cfg.botB}
+
+	players := [2]*models.Player{playerA, playerB}
+	if !aFirst {
+		players = [2]*models.Player{playerB, playerA}
+	}
+
+	game := models.NewGame(players[0], cfg.rules)
+	game.Player2 = players[1]
+	game.State = models.GameStatePlaying
+
+	var bots [2]services.Bot
+	for i, p := range players {
+		bot, err := registry.New(i+1, *p.Bot)
+		if err != nil {
+			log.Fatalf("Failed to create bot %q: %v", p.Bot.Name, err)
+		}
+		bots[i] = bot
+	}
+
+	for i, col := range opening {
+		services.RecordMove(game, col, 1+i%2, players[i%2].ID)
+	}
+	game.CurrentTurn = 1 + len(opening)%2
+
+	var result gameResult
+	for {
+		turn := game.CurrentTurn
+		player := players[turn-1]
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.moveTimeout)
+		start := time.Now()
+		col, err := bots[turn-1].ChooseMove(ctx, game)
+		elapsed := time.Since(start)
+		cancel()
+
+		if player == playerA {
+			result.movesA++
+			result.thinkTimeA += elapsed
+		} else {
+			result.movesB++
+			result.thinkTimeB += elapsed
+		}
+
+		if err == nil {
+			_, err = services.RecordMove(game, col, turn, player.ID)
+		}
+		if err != nil {
+			// A bot that fails to move loses the game
+			if player == playerA {
+				result.forfeit = 1
+				result.score = 0
+			} else {
+				result.forfeit = 2
+				result.score = 1
+			}
+			return result
+		}
+
+		if won, winner, _ := services.CheckWinner(game); won {
+			if winner == playerA {
+				result.score = 1
+			}
+			return result
+		}
+		if services.IsBoardFull(game) {
+			result.score = 0.5
+			return result
+		}
+
+		game.CurrentTurn = 3 - turn
+	}
+}
+
+// eloEstimate converts per-game scores into A's average score and the Elo
+// difference with a 95% confidence interval, using the normal approximation
+// of the score's standard error.
+func eloEstimate(scores []float64) (score float64, diff, low, high eloValue) {
+	n := float64(len(scores))
+	if n == 0 {
+		return 0, 0, 0, 0
+	}
+
+	var sum, sumSq float64
+	for _, s := range scores {
+		sum += s
+		sumSq += s * s
+	}
+	score = sum / n
+	variance := sumSq/n - score*score
+	margin := 1.96 * math.Sqrt(variance/n)
+
+	return score, elo(score), elo(score - margin), elo(score + margin)
+}
+
+// elo returns the rating difference that predicts the given expected score.
+func elo(score float64) eloValue {
+	switch {
+	case score <= 0:
+		return eloValue(math.Inf(-1))
+	case score >= 1:
+		return eloValue(math.Inf(1))
+	}
+	return eloValue(-400 * math.Log10(1/score-1))
+}
+
+func printReport(r Report) {
+	fmt.Printf("A: %s   B: %s   variant: %s\n", specString(r.BotA), specString(r.BotB), r.Variant)
+	fmt.Printf("Games: %d   A wins: %d   draws: %d   B wins: %d\n", r.Games, r.WinsA, r.Draws, r.WinsB)
+	if r.ForfeitsA+r.ForfeitsB > 0 {
+		fmt.Printf("Forfeits: A %d, B %d\n", r.ForfeitsA, r.ForfeitsB)
+	}
+	fmt.Printf("Score A: %.1f%%\n", r.ScoreA*100)
+	fmt.Printf("Elo difference (A - B): %s  (95%% CI %s .. %s)\n", r.EloDiff, r.EloLow, r.EloHigh)
+	fmt.Printf("Average move time: A %.2fms, B %.2fms\n", r.AvgMoveA, r.AvgMoveB)
+	fmt.Printf("Finished in %s\n", time.Duration(r.DurationMs)*time.Millisecond)
+}
+
+func specString(spec models.BotSpec) string {
+	s := spec.Name
+	if spec.Level != "" {
+		s += ":" + string(spec.Level)
+	}
+	if len(spec.Settings) > 0 {
+		values := url.Values{}
+		for k, v := range spec.Settings {
+			values.Set(k, v)
+		}
+		s += "?" + values.Encode()
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// MaxColumns is the widest board a Position can hold.
+const MaxColumns = 16
+
+var (
+	ErrBoardTooLarge = errors.New("board does not fit in a bitboard")
+	ErrInvalidColumn = errors.New("invalid column")
+	ErrColumnFull    = errors.New("column is full")
+)
+
+// Position is a connect-N board stored as one bitmask per player.
+//
+// Each column uses rows+1 consecutive bits, bottom row first, with the extra
+// bit acting as a sentinel so that shifted masks never wrap from one column
+// into the next. A board therefore fits when columns*(rows+1) <= 64.
+//
+// Position is a plain value: assigning it copies the whole board.
+type Position struct {
+	columns  int8
+	rows     int8
+	connectN int8
+	moves    int16
+	masks    [2]uint64        // discs of player 1 and player 2
+	height   [MaxColumns]int8 // number of discs in each column
+}
+
+// Fits reports whether a board of the given size can be represented.
+func Fits(columns, rows int) bool {
+	return columns > 0 && rows > 0 && columns <= MaxColumns && columns*(rows+1) <= 64
+}
+
+// New returns an empty position.
+func New(columns, rows, connectN int) (Position, error) {
+	if !Fits(columns, rows) || connectN < 1 {
+		return Position{}, ErrBoardTooLarge
+	}
+	return Position{
+		columns:  int8(columns),
+		rows:     int8(rows),
+		connectN: int8(connectN),
+	}, nil
+}
+
+// FromBoard builds a position from a row-major board where row 0 is the top
+// and cells hold 0 (empty), 1 or 2.
+func FromBoard(board [][]int, connectN int) (Position, error) {
+	rows := len(board)
+	columns := 0
+	if rows > 0 {
+		columns = len(board[0])
+	}
+
+	p, err := New(columns, rows, connectN)
+	if err != nil {
+		return p, err
+	}
+
+	for c := 0; c < columns; c++ {
+		for r := rows - 1; r >= 0; r-- {
+			player := board[r][c]
+			if player == 0 {
+				break
+			}
+			p.Play(c, player)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Position) Columns() int  { return int(p.columns) }
+func (p *Position) Rows() int     { return int(p.rows) }
+func (p *Position) ConnectN() int { return int(p.connectN) }
+
+// Moves returns the number of discs on the board.
+func (p *Position) Moves() int { return int(p.moves) }
+
+// Height returns the number of discs in a column.
+func (p *Position) Height(col int) int { return int(p.height[col]) }
+
+// Turn returns the player to move, assuming players alternate from player 1.
+func (p *Position) Turn() int { return 1 + int(p.moves)%2 }
+
+// Cell returns the player occupying a cell, or 0 if it is empty. Rows are
+// counted from the bottom.
+func (p *Position) Cell(col, row int) int {
+	bit := p.bit(col, row)
+	switch {
+	case p.masks[0]&bit != 0:
+		return 1
+	case p.masks[1]&bit != 0:
+		return 2
+	}
+	return 0
+}
+
+// Mask returns the discs of the given player.
+func (p *Position) Mask(player int) uint64 { return p.masks[player-1] }
+
+// Occupied returns the discs of both players.
+func (p *Position) Occupied() uint64 { return p.masks[0] | p.masks[1] }
+
+// CanPlay reports whether a disc can be dropped in the column.
+func (p *Position) CanPlay(col int) bool {
+	return col >= 0 && col < int(p.columns) && p.height[col] < p.rows
+}
+
+// Play drops a disc for player in the column and returns the row it landed
+// on, counted from the bottom.
+func (p *Position) Play(col, player int) (int, error) {
+	if col < 0 || col >= int(p.columns) {
+		return -1, ErrInvalidColumn
+	}
+	if p.height[col] >= p.rows {
+		return -1, ErrColumnFull
+	}
+
+	row := int(p.height[col])
+	p.masks[player-1] |= p.bit(col, row)
+	p.height[col]++
+	p.moves++
+
+	return row, nil
+}
+
+// IsWinningMove reports whether dropping a disc for player in the column
+// would complete a line. The position is left unchanged.
+func (p *Position) IsWinningMove(col, player int) bool {
+	if !p.CanPlay(col) {
+		return false
+	}
+	mask := p.masks[player-1] | p.bit(col, int(p.height[col]))
+	return p.aligned(mask) != 0
+}
+
+// HasWon reports whether player has a complete line anywhere on the board.
+func (p *Position) HasWon(player int) bool {
+	return p.aligned(p.masks[player-1]) != 0
+}
+
+// WinningLine returns the (column, row-from-bottom) cells of one of the
+// player's complete lines, or nil if there is none.
+func (p *Position) WinningLine(player int) [][2]int {
+	mask := p.masks[player-1]
+	for _, shift := range p.directions() {
+		start := p.run(mask, shift)
+		if start == 0 {
+			continue
+		}
+
+		b := uint(bits.TrailingZeros64(start))
+		line := make([][2]int, 0, p.connectN)
+		for i := 0; i < int(p.connectN); i++ {
+			line = append(line, p.cell(b+uint(i)*shift))
+		}
+		return line
+	}
+	return nil
+}
+
+// IsFull reports whether every cell is occupied.
+func (p *Position) IsFull() bool {
+	return int(p.moves) == int(p.columns)*int(p.rows)
+}
+
+func (p *Position) bit(col, row int) uint64 {
+	return 1 << (uint(col)*uint(p.rows+1) + uint(row))
+}
+
+func (p *Position) cell(b uint) [2]int {
+	stride := uint(p.rows + 1)
+	return [2]int{int(b / stride), int(b % stride)}
+}
+
+// directions returns the bit shifts for vertical, horizontal and both
+// diagonal lines.
+func (p *Position) directions() [4]uint {
+	h := uint(p.rows)
+	return [4]uint{1, h + 1, h, h + 2}
+}
+
+// aligned returns a non-zero value if mask contains connectN discs in a row
+// in any direction.
+func (p *Position) aligned(mask uint64) uint64 {
+	var found uint64
+	for _, shift := range p.directions() {
+		found |= p.run(mask, shift)
+	}
+	return found
+}
+
+// run returns the bits of mask that start a line of connectN discs in the
+// given direction. The run length doubles on each step, so the cost grows
+// with log(connectN) rather than connectN.
+func (p *Position) run(mask uint64, shift uint) uint64 {
+	n := int(p.connectN)
+	for k := 1; k < n; {
+		step := k
+		if n-k < step {
+			step = n - k
+		}
+		mask &= mask >> (uint(step) * shift)
+		k += step
+	}
+	return mask
+}
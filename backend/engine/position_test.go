@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// benchMoves is a standard-board game, 20 moves in, with no line yet.
+var benchMoves = []int{3, 2, 4, 1, 5, 6, 6, 3, 2, 4, 1, 5, 0, 6, 3, 2, 4, 1, 5, 0}
+
+// sliceBoard is the [][]int board the game logic used before Position,
+// kept as the baseline the benchmarks compare against. Row 0 is the top.
+type sliceBoard struct {
+	cells    [][]int
+	connectN int
+}
+
+func newSliceBoard(columns, rows, connectN int) *sliceBoard {
+	cells := make([][]int, rows)
+	for r := range cells {
+		cells[r] = make([]int, columns)
+	}
+	return &sliceBoard{cells: cells, connectN: connectN}
+}
+
+func (b *sliceBoard) reset() {
+	for _, row := range b.cells {
+		for c := range row {
+			row[c] = 0
+		}
+	}
+}
+
+// play drops a disc and returns the row it landed on, counted from the top.
+func (b *sliceBoard) play(col, player int) (int, error) {
+	if col < 0 || col >= len(b.cells[0]) {
+		return -1, ErrInvalidColumn
+	}
+	for r := len(b.cells) - 1; r >= 0; r-- {
+		if b.cells[r][col] == 0 {
+			b.cells[r][col] = player
+			return r, nil
+		}
+	}
+	return -1, ErrColumnFull
+}
+
+// hasWonAt reports whether the disc at (row, col) is part of a line.
+func (b *sliceBoard) hasWonAt(row, col int) bool {
+	player := b.cells[row][col]
+	for _, d := range [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+		count := 1
+		for _, sign := range []int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for r >= 0 && r < len(b.cells) && c >= 0 && c < len(b.cells[0]) && b.cells[r][c] == player {
+				count++
+				r, c = r+sign*d[0], c+sign*d[1]
+			}
+		}
+		if count >= b.connectN {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWon reports whether player has a line anywhere on the board.
+func (b *sliceBoard) hasWon(player int) bool {
+	for r, row := range b.cells {
+		for c, cell := range row {
+			if cell == player && b.hasWonAt(r, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseBoard reads a board drawn top row first, with X for player 1, O for
+// player 2 and . for an empty cell.
+func parseBoard(t *testing.T, drawing string, connectN int) (Position, *sliceBoard) {
+	t.Helper()
+	lines := strings.Fields(drawing)
+	board := newSliceBoard(len(lines[0]), len(lines), connectN)
+	for r, line := range lines {
+		for c, ch := range line {
+			board.cells[r][c] = strings.IndexRune(".XO", ch)
+		}
+	}
+
+	p, err := FromBoard(board.cells, connectN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, board
+}
+
+// checkLine fails the test unless line is connectN of player's cells in a
+// row in one direction.
+func checkLine(t *testing.T, p *Position, player int, line [][2]int) {
+	t.Helper()
+	if len(line) != p.ConnectN() {
+		t.Fatalf("line %v has %d cells, want %d", line, len(line), p.ConnectN())
+	}
+	dc, dr := line[1][0]-line[0][0], line[1][1]-line[0][1]
+	if dc < -1 || dc > 1 || dr < -1 || dr > 1 || (dc == 0 && dr == 0) {
+		t.Fatalf("line %v doesn't run in a direction", line)
+	}
+	for i, cell := range line {
+		if cell[0] != line[0][0]+i*dc || cell[1] != line[0][1]+i*dr {
+			t.Fatalf("line %v isn't straight", line)
+		}
+		if p.Cell(cell[0], cell[1]) != player {
+			t.Fatalf("line %v includes cell %v, which isn't player %d's", line, cell, player)
+		}
+	}
+}
+
+func TestHasWonMatchesSliceBoard(t *testing.T) {
+	tests := []struct {
+		name     string
+		connectN int
+		board    string
+		winner   int
+	}{
+		{"7x6 horizontal", 4, `
+			.......
+			.......
+			.......
+			.......
+			OOO....
+			.XXXX..`, 1},
+		{"7x6 vertical", 4, `
+			.......
+			.......
+			...O...
+			...O...
+			..XOX..
+			.XXOX..`, 2},
+		{"7x6 rising diagonal", 4, `
+			.......
+			.......
+			....X..
+			...XO..
+			..XOO..
+			.XOXO..`, 1},
+		{"7x6 falling diagonal", 4, `
+			.......
+			.......
+			.O.....
+			.XO....
+			.XXO...
+			XOXXO..`, 2},
+		{"7x6 three in a row", 4, `
+			.......
+			.......
+			.......
+			.......
+			OO.....
+			.XXX.O.`, 0},
+		{"8x7 top right corner", 4, `
+			....XXXX
+			....OOOX
+			....XXXO
+			....OOOX
+			....XXXO
+			....OOOX
+			....XXXO`, 1},
+		{"8x7 rising diagonal into the last bit", 4, `
+			.......X
+			......XO
+			.....XOO
+			....XOXX
+			....XXOX
+			....XOXO
+			....OXOX`, 1},
+		{"connect5 five across", 5, `
+			.........
+			.........
+			.........
+			.........
+			OOOO.....
+			XXXXX....`, 1},
+		{"connect5 four across", 5, `
+			.........
+			.........
+			.........
+			.........
+			OOO......
+			.XXXX.O..`, 0},
+		{"connect5 diagonal", 5, `
+			.........
+			....O....
+			...OX....
+			..OXX....
+			.OXXO....
+			OXXOX....`, 2},
+		// Without the sentinel row these discs would line up across
+		// column ends
+		{"vertical across a column break", 4, `
+			X......
+			X......
+			O......
+			O......
+			XX.....
+			OX.....`, 0},
+		{"rising diagonal across a column break", 4, `
+			..X....
+			.XO....
+			XOO....
+			OOX....
+			XXO....
+			OOX.X..`, 0},
+		{"falling diagonal across a column break", 4, `
+			..X....
+			..O....
+			..X....
+			X.O....
+			OXO....
+			OOX....`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, board := parseBoard(t, tt.board, tt.connectN)
+			for player := 1; player <= 2; player++ {
+				won := p.HasWon(player)
+				if won != board.hasWon(player) {
+					t.Errorf("player %d: bitboard says %v, slice board %v", player, won, board.hasWon(player))
+				}
+				if want := player == tt.winner; won != want {
+					t.Errorf("player %d: HasWon %v, want %v", player, won, want)
+				}
+
+				line := p.WinningLine(player)
+				if won {
+					checkLine(t, &p, player, line)
+				} else if line != nil {
+					t.Errorf("player %d has no line but WinningLine returned %v", player, line)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayMatchesSliceBoard(t *testing.T) {
+	sizes := []struct{ columns, rows, connectN int }{
+		{7, 6, 4},
+		{8, 7, 4}, // uses all 64 bits
+		{9, 6, 5},
+		{4, 4, 3},
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	for _, size := range sizes {
+		for game := 0; game < 200; game++ {
+			p, err := New(size.columns, size.rows, size.connectN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			board := newSliceBoard(size.columns, size.rows, size.connectN)
+
+			for player := 1; !p.IsFull(); player = 3 - player {
+				// Off-board and full columns must be refused by both
+				col := rng.Intn(size.columns+2) - 1
+				wins := p.IsWinningMove(col, player)
+
+				row, err := p.Play(col, player)
+				sliceRow, sliceErr := board.play(col, player)
+				if err != sliceErr {
+					t.Fatalf("%dx%d column %d: bitboard error %v, slice board %v", size.columns, size.rows, col, err, sliceErr)
+				}
+				if err != nil {
+					player = 3 - player
+					continue
+				}
+				if row != size.rows-1-sliceRow {
+					t.Fatalf("%dx%d column %d: landed on row %d, slice board row %d from the top", size.columns, size.rows, col, row, sliceRow)
+				}
+				if p.Cell(col, row) != player {
+					t.Fatalf("%dx%d: cell (%d, %d) holds %d, want %d", size.columns, size.rows, col, row, p.Cell(col, row), player)
+				}
+
+				won := board.hasWonAt(sliceRow, col)
+				if wins != won || p.HasWon(player) != won {
+					t.Fatalf("%dx%d column %d: IsWinningMove %v, HasWon %v, slice board %v", size.columns, size.rows, col, wins, p.HasWon(player), won)
+				}
+				if won {
+					checkLine(t, &p, player, p.WinningLine(player))
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkPlay(b *testing.B) {
+	b.Run("bitboard", func(b *testing.B) {
+		empty, _ := New(7, 6, 4)
+		for i := 0; i < b.N; i++ {
+			p := empty
+			for j, col := range benchMoves {
+				p.Play(col, 1+j%2)
+			}
+		}
+	})
+
+	b.Run("slice", func(b *testing.B) {
+		board := newSliceBoard(7, 6, 4)
+		for i := 0; i < b.N; i++ {
+			board.reset()
+			for j, col := range benchMoves {
+				board.play(col, 1+j%2)
+			}
+		}
+	})
+}
+
+func BenchmarkCheckWin(b *testing.B) {
+	p, _ := New(7, 6, 4)
+	board := newSliceBoard(7, 6, 4)
+	var row int
+	for j, col := range benchMoves {
+		p.Play(col, 1+j%2)
+		row, _ = board.play(col, 1+j%2)
+	}
+	last, player := benchMoves[len(benchMoves)-1], 2-len(benchMoves)%2
+	if p.HasWon(player) != board.hasWonAt(row, last) {
+		b.Fatal("bitboard and slice board disagree")
+	}
+
+	b.Run("bitboard", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p.HasWon(player)
+		}
+	})
+
+	b.Run("slice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			board.hasWonAt(row, last)
+		}
+	})
+}
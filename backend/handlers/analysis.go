@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"connect-four-backend/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// HandleGames serves the per-game endpoints under /api/games/.
+func HandleGames(w http.ResponseWriter, r *http.Request, gameService *services.GameService, hub *Hub) {
+	// POST /api/games/bot
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/games/"), "/")
+	if len(parts) == 1 && parts[0] == "bot" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handleStartBotGame(w, r, gameService)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /api/games/live or /api/games/{id}/analysis
+	if len(parts) == 1 && parts[0] == "live" {
+		handleLiveGames(w, gameService, hub)
+		return
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "analysis" {
+		http.NotFound(w, r)
+		return
+	}
+
+	handleGameAnalysis(w, parts[0], gameService)
+}
+
+func handleGameAnalysis(w http.ResponseWriter, gameID string, gameService *services.GameService) {
+	analysis, err := gameService.GetGameAnalysis(gameID)
+	switch {
+	case errors.Is(err, services.ErrAnalysisPending):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "pending"})
+		return
+	case errors.Is(err, services.ErrGameNotFound):
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to get analysis", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analysis)
+}
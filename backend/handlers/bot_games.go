@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// botGameRequest is the body of POST /api/games/bot.
+type botGameRequest struct {
+	Bot1    models.BotSpec `json:"bot1"`
+	Bot2    models.BotSpec `json:"bot2"`
+	Variant string         `json:"variant"`
+}
+
+// handleStartBotGame starts a game between two bots that the server plays
+// out with no client connected.
+func handleStartBotGame(w http.ResponseWriter, r *http.Request, gameService *services.GameService) {
+	var req botGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid bot game request", http.StatusBadRequest)
+		return
+	}
+
+	rules, ok := models.RulesForVariant(req.Variant)
+	if !ok {
+		http.Error(w, "Unknown game variant", http.StatusBadRequest)
+		return
+	}
+	for _, spec := range []models.BotSpec{req.Bot1, req.Bot2} {
+		if _, ok := models.ParseBotLevel(string(spec.Level)); !ok {
+			http.Error(w, "Unknown bot level", http.StatusBadRequest)
+			return
+		}
+	}
+
+	game, err := gameService.StartBotGame(req.Bot1, req.Bot2, rules)
+	switch {
+	case errors.Is(err, services.ErrTooManyBotGames):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(game)
+}
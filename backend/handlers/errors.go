@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/services"
+	"errors"
+	"log"
+)
+
+// errorCodes maps the errors GameService and RoomService return to the
+// codes clients see.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{services.ErrGameNotFound, models.CodeGameNotFound},
+	{services.ErrNotInGame, models.CodeNotInGame},
+	{services.ErrGameOver, models.CodeGameOver},
+	{services.ErrGamePaused, models.CodeGamePaused},
+	{services.ErrGameInProgress, models.CodeGameInProgress},
+
+	{services.ErrNotYourTurn, models.CodeNotYourTurn},
+	{services.ErrInvalidColumn, models.CodeInvalidColumn},
+	{services.ErrColumnFull, models.CodeColumnFull},
+	{services.ErrStaleMove, models.CodeStaleMove},
+	{services.ErrOutOfTime, models.CodeOutOfTime},
+
+	{services.ErrHintsDisabled, models.CodeHintsDisabled},
+	{services.ErrNoHintsLeft, models.CodeNoHintsLeft},
+	{services.ErrHintPending, models.CodeHintPending},
+	{services.ErrStaleHint, models.CodeStaleHint},
+	{services.ErrNoValidMove, models.CodeNoValidMove},
+	{services.ErrNoDrawOffer, models.CodeNoDrawOffer},
+	{services.ErrTooLateToAbort, models.CodeTooLateToAbort},
+
+	{services.ErrInvalidSeries, models.CodeInvalidSeries},
+	{services.ErrNoRematchOffer, models.CodeNoRematchOffer},
+	{services.ErrRematchUnavailable, models.CodeRematchUnavailable},
+	{services.ErrRoomNotFound, models.CodeRoomNotFound},
+	{services.ErrOwnRoom, models.CodeOwnRoom},
+
+	{services.ErrInvalidSession, models.CodeInvalidSession},
+}
+
+// errorPayload describes an error for a client. Errors without a code are
+// logged rather than shown, since they may give away server internals.
+func errorPayload(err error) models.ErrorPayload {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return models.ErrorPayload{Message: err.Error(), Code: known.code}
+		}
+	}
+
+	log.Printf("Unexpected error: %v", err)
+	return models.ErrorPayload{Message: "Something went wrong", Code: models.CodeInternal}
+}
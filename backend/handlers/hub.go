@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/services"
+	"sync"
+	"time"
+)
+
+const (
+	// gameLogSize is how many recent messages are kept for each game, for
+	// players who reconnect after missing some.
+	gameLogSize = 100
+
+	// finishedLogTTL is how long the log of a finished game is kept.
+	finishedLogTTL = 10 * time.Minute
+)
+
+// gameLog numbers the messages sent about one game and keeps the latest of
+// them, along with the game state they last carried.
+type gameLog struct {
+	seq      int64
+	messages []loggedMessage // oldest first
+	game     *models.Game
+	finished time.Time
+}
+
+type loggedMessage struct {
+	to  string // ID of the only player the message was for, if any
+	msg models.WSMessage
+}
+
+// missed returns the messages for a player sent after seq. It returns nil
+// if some of them have already been dropped from the log, or seq is from
+// before a restart.
+func (l *gameLog) missed(playerID string, seq int64) []models.WSMessage {
+	if seq > l.seq || (len(l.messages) > 0 && seq < l.messages[0].msg.Seq-1) {
+		return nil
+	}
+
+	var missed []models.WSMessage
+	for _, m := range l.messages {
+		if m.msg.Seq > seq && (m.to == "" || m.to == playerID) {
+			missed = append(missed, m.msg)
+		}
+	}
+	return missed
+}
+
+// Hub connects clients to games. It knows which client plays as which
+// player and who is watching which game, and turns the events GameService
+// publishes into messages for everyone on the game.
+type Hub struct {
+	gameService *services.GameService
+
+	mu         sync.RWMutex
+	players    map[string]*Client          // playerID -> connected client
+	spectators map[string]map[*Client]bool // gameID -> watching clients
+	watching   map[*Client]string          // client -> gameID it watches
+	logs       map[string]*gameLog         // gameID -> recent messages
+}
+
+func NewHub(gameService *services.GameService) *Hub {
+	return &Hub{
+		gameService: gameService,
+		players:     make(map[string]*Client),
+		spectators:  make(map[string]map[*Client]bool),
+		watching:    make(map[*Client]string),
+		logs:        make(map[string]*gameLog),
+	}
+}
+
+// Run delivers game events to the clients on each game until the game
+// service stops.
+func (h *Hub) Run() {
+	for event := range h.gameService.Events() {
+		h.dispatch(event)
+	}
+}
+
+func (h *Hub) dispatch(event services.GameEvent) {
+	game := event.Game
+
+	h.mu.Lock()
+	h.log(game.ID).game = game
+	h.mu.Unlock()
+
+	switch event.Type {
+	case services.EventGameStarted:
+		h.pruneLogs(time.Now())
+		for i, player := range []*models.Player{game.Player1, game.Player2} {
+			h.sendTo(game.ID, player.ID, models.WSMessage{
+				Type: models.MsgTypeGameStart,
+				Payload: models.GameStartPayload{
+					Game:         game,
+					YourPlayerID: player.ID,
+					SessionToken: h.gameService.SessionToken(game, i+1),
+				},
+			})
+		}
+
+	case services.EventGameUpdated:
+		message := ""
+		if last := game.Moves[len(game.Moves)-1]; playerByNum(game, last.PlayerNum).IsBot {
+			message = "Bot made a move"
+		}
+		h.broadcast(game, models.WSMessage{
+			Type:    models.MsgTypeGameUpdate,
+			Payload: gameUpdatePayload(game, message),
+		})
+
+	case services.EventGameResumed:
+		h.broadcast(game, models.WSMessage{
+			Type:    models.MsgTypeGameUpdate,
+			Payload: gameUpdatePayload(game, "Both players are back, game resumed"),
+		})
+
+	case services.EventGameOver:
+		h.broadcast(game, models.WSMessage{
+			Type:    models.MsgTypeGameOver,
+			Payload: gameOverPayload(game),
+		})
+
+		// Spectators are let go once the game is over
+		h.mu.Lock()
+		for client := range h.spectators[game.ID] {
+			delete(h.watching, client)
+		}
+		delete(h.spectators, game.ID)
+		h.log(game.ID).finished = time.Now()
+		h.mu.Unlock()
+	}
+}
+
+// Register makes a client reachable as the given player, replacing any
+// earlier connection of the same player.
+func (h *Hub) Register(playerID string, client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.players[playerID] = client
+}
+
+// Rejoin registers a client for a player coming back to a game. Messages
+// the player missed since lastSeq are sent again if they are still in the
+// log, followed by the current state of the game, which carries the
+// player's new session token. game is used for the state if the hub hasn't
+// seen the game yet.
+func (h *Hub) Rejoin(client *Client, playerID string, game *models.Game, lastSeq int64, token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.players[playerID] = client
+
+	log := h.log(game.ID)
+	if log.game != nil {
+		game = log.game
+	}
+	if lastSeq > 0 {
+		for _, msg := range log.missed(playerID, lastSeq) {
+			client.sendMessage(msg)
+		}
+	}
+
+	snapshot := gameUpdatePayload(game, "Reconnected successfully")
+	snapshot.SessionToken = token
+	client.sendMessage(models.WSMessage{
+		Type:    models.MsgTypeGameUpdate,
+		GameID:  game.ID,
+		Seq:     log.seq,
+		Payload: snapshot,
+	})
+}
+
+// Leave forgets a client that disconnected.
+func (h *Hub) Leave(client *Client) {
+	h.Unwatch(client)
+
+	if client.player == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.players[client.player.ID] == client {
+		delete(h.players, client.player.ID)
+	}
+}
+
+// Watch makes a client a spectator of a game, instead of any game it was
+// watching before, and sends it the current state of the game. The state
+// is numbered with the game's latest sequence number and sent with the
+// lock held, so the spectator gets every message after it and none before.
+// game is used for the state if the hub hasn't seen the game yet. Watch
+// reports false if the game has finished.
+func (h *Hub) Watch(client *Client, game *models.Game) bool {
+	h.Unwatch(client)
+
+	h.mu.Lock()
+	log := h.log(game.ID)
+	if log.game != nil {
+		game = log.game
+	}
+	if game.State != models.GameStatePlaying {
+		h.mu.Unlock()
+		return false
+	}
+
+	if h.spectators[game.ID] == nil {
+		h.spectators[game.ID] = make(map[*Client]bool)
+	}
+	h.spectators[game.ID][client] = true
+	h.watching[client] = game.ID
+	client.sendMessage(models.WSMessage{
+		Type:    models.MsgTypeGameUpdate,
+		GameID:  game.ID,
+		Seq:     log.seq,
+		Payload: gameUpdatePayload(game, "Now spectating"),
+	})
+	h.mu.Unlock()
+
+	h.announceSpectators(game)
+	return true
+}
+
+// Unwatch stops a client spectating, if it is.
+func (h *Hub) Unwatch(client *Client) {
+	h.mu.Lock()
+	gameID, ok := h.watching[client]
+	if ok {
+		delete(h.watching, client)
+		delete(h.spectators[gameID], client)
+		if len(h.spectators[gameID]) == 0 {
+			delete(h.spectators, gameID)
+		}
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if game := h.gameService.GetGameSnapshot(gameID); game != nil && game.State == models.GameStatePlaying {
+		h.announceSpectators(game)
+	}
+}
+
+// SpectatorCount returns how many clients are watching a game.
+func (h *Hub) SpectatorCount(gameID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.spectators[gameID])
+}
+
+// SendToOpponent sends a message to the opponent of the given player, if
+// they are a connected human.
+func (h *Hub) SendToOpponent(game *models.Game, playerID string, msg models.WSMessage) {
+	if game == nil || game.Player2 == nil {
+		return
+	}
+
+	opponent := game.Player1
+	if playerID == game.Player1.ID {
+		opponent = game.Player2
+	}
+	if opponent.IsBot {
+		return
+	}
+	h.sendTo(game.ID, opponent.ID, msg)
+}
+
+// sendTo numbers a message about a game and sends it to one player.
+func (h *Hub) sendTo(gameID string, playerID string, msg models.WSMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg = h.record(gameID, playerID, msg)
+	if client := h.players[playerID]; client != nil {
+		client.sendMessage(msg)
+	}
+}
+
+// broadcast numbers a message about a game and sends it to the players and
+// everyone watching. Messages are sent with the lock held, so every client
+// gets them in sequence.
+func (h *Hub) broadcast(game *models.Game, msg models.WSMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg = h.record(game.ID, "", msg)
+	for _, player := range []*models.Player{game.Player1, game.Player2} {
+		if client := h.players[player.ID]; client != nil {
+			client.sendMessage(msg)
+		}
+	}
+	for client := range h.spectators[game.ID] {
+		client.sendMessage(msg)
+	}
+}
+
+// record gives a message the game's next sequence number and adds it to
+// the game's log. Must be called with mu held.
+func (h *Hub) record(gameID string, to string, msg models.WSMessage) models.WSMessage {
+	log := h.log(gameID)
+	log.seq++
+	msg.GameID = gameID
+	msg.Seq = log.seq
+
+	log.messages = append(log.messages, loggedMessage{to: to, msg: msg})
+	if len(log.messages) > gameLogSize {
+		log.messages = log.messages[len(log.messages)-gameLogSize:]
+	}
+	return msg
+}
+
+// log returns a game's message log, starting one if needed. Must be called
+// with mu held.
+func (h *Hub) log(gameID string) *gameLog {
+	log := h.logs[gameID]
+	if log == nil {
+		log = &gameLog{}
+		h.logs[gameID] = log
+	}
+	return log
+}
+
+// pruneLogs drops the logs of games that finished a while ago.
+func (h *Hub) pruneLogs(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for gameID, log := range h.logs {
+		if !log.finished.IsZero() && now.Sub(log.finished) > finishedLogTTL {
+			delete(h.logs, gameID)
+		}
+	}
+}
+
+// announceSpectators tells the players and spectators of a game how many
+// people are watching it.
+func (h *Hub) announceSpectators(game *models.Game) {
+	h.broadcast(game, models.WSMessage{
+		Type: models.MsgTypeSpectators,
+		Payload: models.SpectatorsPayload{
+			GameID: game.ID,
+			Count:  h.SpectatorCount(game.ID),
+		},
+	})
+}
+
+func playerByNum(game *models.Game, playerNum int) *models.Player {
+	if playerNum == 2 {
+		return game.Player2
+	}
+	return game.Player1
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/services"
+	"encoding/json"
+	"net/http"
+)
+
+// handleLiveGames lists the games in progress that can be watched.
+func handleLiveGames(w http.ResponseWriter, gameService *services.GameService, hub *Hub) {
+	live := gameService.LiveGames()
+	for i := range live {
+		live[i].Spectators = hub.SpectatorCount(live[i].ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(live)
+}
+
+func (c *Client) handleSpectate(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var spectateData models.SpectatePayload
+	if err := json.Unmarshal(data, &spectateData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid spectate data")
+		return
+	}
+
+	if game := c.currentGame(); game != nil && game.State == models.GameStatePlaying {
+		c.sendError(models.CodeAlreadyPlaying, "Cannot spectate while playing")
+		return
+	}
+
+	game := c.service.GetGameSnapshot(spectateData.GameID)
+	if game == nil || game.State != models.GameStatePlaying {
+		c.sendError(models.CodeGameNotFound, "Game not found or already finished")
+		return
+	}
+
+	if !c.hub.Watch(c, game) {
+		c.sendError(models.CodeGameNotFound, "Game not found or already finished")
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"connect-four-backend/models"
 	"connect-four-backend/services"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -21,18 +22,15 @@ var upgrader = websocket.Upgrader{
 type Client struct {
 	conn        *websocket.Conn
 	player      *models.Player
-	gameID      string
 	send        chan []byte
+	hub         *Hub
 	service     *services.GameService
 	matchmaking *services.MatchmakingService
+	rooms       *services.RoomService
+	closeOnce   sync.Once
 }
 
-var (
-	clients      = make(map[string]*Client) // playerID -> client
-	clientsMutex sync.RWMutex
-)
-
-func HandleWebSocket(w http.ResponseWriter, r *http.Request, gameService *services.GameService, matchmakingService *services.MatchmakingService) {
+func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *Hub, gameService *services.GameService, matchmakingService *services.MatchmakingService, roomService *services.RoomService) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
@@ -42,8 +40,10 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, gameService *servic
 	client := &Client{
 		conn:        conn,
 		send:        make(chan []byte, 256),
+		hub:         hub,
 		service:     gameService,
 		matchmaking: matchmakingService,
+		rooms:       roomService,
 	}
 
 	go client.writePump()
@@ -118,6 +118,28 @@ func (c *Client) handleMessage(msg models.WSMessage) {
 		c.handleMove(msg.Payload)
 	case models.MsgTypeReconnect:
 		c.handleReconnect(msg.Payload)
+	case models.MsgTypeRequestHint:
+		c.handleRequestHint()
+	case models.MsgTypeCreateRoom:
+		c.handleCreateRoom(msg.Payload)
+	case models.MsgTypeJoinRoom:
+		c.handleJoinRoom(msg.Payload)
+	case models.MsgTypeOfferRematch:
+		c.handleOfferRematch(msg.Payload)
+	case models.MsgTypeAcceptRematch:
+		c.handleAcceptRematch()
+	case models.MsgTypeResign:
+		c.handleResign()
+	case models.MsgTypeOfferDraw:
+		c.handleOfferDraw()
+	case models.MsgTypeAcceptDraw:
+		c.handleAcceptDraw()
+	case models.MsgTypeDeclineDraw:
+		c.handleDeclineDraw()
+	case models.MsgTypeAbort:
+		c.handleAbort()
+	case models.MsgTypeSpectate:
+		c.handleSpectate(msg.Payload)
 	}
 }
 
@@ -125,7 +147,7 @@ func (c *Client) handleJoinQueue(payload interface{}) {
 	data, _ := json.Marshal(payload)
 	var joinData models.JoinQueuePayload
 	if err := json.Unmarshal(data, &joinData); err != nil {
-		c.sendError("Invalid join queue data")
+		c.sendError(models.CodeInvalidPayload, "Invalid join queue data")
 		return
 	}
 
@@ -135,371 +157,424 @@ func (c *Client) handleJoinQueue(payload interface{}) {
 		return
 	}
 
-	// Create new player
-	c.player = &models.Player{
-		ID:       services.GeneratePlayerID(),
-		Username: joinData.Username,
-		IsBot:    false,
+	rules, ok := models.RulesForVariant(joinData.Variant)
+	if !ok {
+		c.sendError(models.CodeUnknownVariant, "Unknown game variant")
+		return
 	}
 
-	// Register client
-	clientsMutex.Lock()
-	clients[c.player.ID] = c
-	clientsMutex.Unlock()
+	botLevel, ok := models.ParseBotLevel(joinData.BotLevel)
+	if !ok {
+		c.sendError(models.CodeUnknownBotLevel, "Unknown bot level")
+		return
+	}
+
+	if !joinData.TimeControl.Valid() {
+		c.sendError(models.CodeInvalidTimeControl, "Invalid time control")
+		return
+	}
 
-	// Add to matchmaking queue
-	c.matchmaking.AddToQueue(c.player)
+	// Create and register a new player
+	c.registerPlayer(joinData.Username)
 
-	// Start checking for game start
-	go c.waitForGameStart()
+	// Add to matchmaking queue; game_start follows as soon as a match is made
+	c.matchmaking.AddToQueue(c.player, services.QueueOptions{
+		Rules:       rules,
+		BotLevel:    botLevel,
+		Rated:       !joinData.Casual,
+		TimeControl: joinData.TimeControl,
+	})
 }
 
-func (c *Client) waitForGameStart() {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	timeout := time.After(15 * time.Second)
+func (c *Client) handleCreateRoom(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var roomData models.CreateRoomPayload
+	if err := json.Unmarshal(data, &roomData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid create room data")
+		return
+	}
 
-	for {
-		select {
-		case <-timeout:
-			return
-		case <-ticker.C:
-			game := c.service.GetPlayerGame(c.player.ID)
-			if game != nil && game.State == models.GameStatePlaying {
-				c.gameID = game.ID
-				c.matchmaking.RemoveFromQueue(c.player.ID)
-
-				// Notify player
-				c.sendMessage(models.WSMessage{
-					Type: models.MsgTypeGameStart,
-					Payload: models.GameStartPayload{
-						Game:         game,
-						YourPlayerID: c.player.ID,
-					},
-				})
-
-				// Notify opponent if not bot
-				if game.Player2 != nil && !game.Player2.IsBot {
-					c.notifyOpponent(game, models.MsgTypeGameStart)
-				}
-
-				// If opponent is bot, make bot move if it's bot's turn
-				if game.Player2.IsBot && game.CurrentTurn == 2 {
-					time.Sleep(1 * time.Second)
-					c.makeBotMove(game)
-				}
+	rules, ok := models.RulesForVariant(roomData.Variant)
+	if !ok {
+		c.sendError(models.CodeUnknownVariant, "Unknown game variant")
+		return
+	}
 
-				return
-			}
-		}
+	if !roomData.TimeControl.Valid() {
+		c.sendError(models.CodeInvalidTimeControl, "Invalid time control")
+		return
 	}
-}
 
-func (c *Client) handleMove(payload interface{}) {
-	if c.player == nil || c.gameID == "" {
-		c.sendError("Not in a game")
+	c.registerPlayer(roomData.Username)
+
+	room, err := c.rooms.CreateRoom(c.player, services.GameOptions{
+		Rules:       rules,
+		Rated:       !roomData.Casual,
+		BestOf:      roomData.BestOf,
+		TimeControl: roomData.TimeControl,
+	})
+	if err != nil {
+		c.sendServiceError(err)
 		return
 	}
 
+	c.sendMessage(models.WSMessage{
+		Type: models.MsgTypeRoomCreated,
+		Payload: models.RoomCreatedPayload{
+			Code:      room.Code,
+			Rules:     room.Rules,
+			Rated:     room.Rated,
+			BestOf:    room.BestOf,
+			ExpiresAt: room.ExpiresAt(),
+
+			TimeControl: room.TimeControl,
+		},
+	})
+}
+
+func (c *Client) handleJoinRoom(payload interface{}) {
 	data, _ := json.Marshal(payload)
-	var moveData models.MovePayload
-	if err := json.Unmarshal(data, &moveData); err != nil {
-		c.sendError("Invalid move data")
+	var joinData models.JoinRoomPayload
+	if err := json.Unmarshal(data, &joinData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid join room data")
 		return
 	}
 
-	game := c.service.GetGame(c.gameID)
-	if game == nil {
-		c.sendError("Game not found")
-		return
+	c.registerPlayer(joinData.Username)
+
+	if _, err := c.rooms.JoinRoom(joinData.Code, c.player); err != nil {
+		c.sendServiceError(err)
 	}
+}
 
-	// Check if it's the player's turn
-	playerNum := 1
-	if c.player.ID == game.Player2.ID {
-		playerNum = 2
+// registerPlayer gives the client a new player and makes it reachable by
+// player ID. A player the client had before leaves the queue and any room
+// it opened, and the client stops spectating.
+func (c *Client) registerPlayer(username string) {
+	if c.player != nil {
+		c.matchmaking.RemoveFromQueue(c.player.ID)
+		c.rooms.CloseRoomsHostedBy(c.player.ID)
 	}
+	c.hub.Leave(c)
 
-	if game.CurrentTurn != playerNum {
-		c.sendMessage(models.WSMessage{
-			Type: models.MsgTypeInvalidMove,
-			Payload: models.ErrorPayload{
-				Message: "Not your turn",
-			},
-		})
+	c.player = &models.Player{
+		ID:       services.GeneratePlayerID(),
+		Username: username,
+		IsBot:    false,
+	}
+	c.hub.Register(c.player.ID, c)
+}
+
+// currentGame returns the game the client's player is in, which may have
+// finished, or nil.
+func (c *Client) currentGame() *models.Game {
+	if c.player == nil {
+		return nil
+	}
+	return c.service.GetPlayerGame(c.player.ID)
+}
+
+func (c *Client) currentGameID() string {
+	if game := c.currentGame(); game != nil {
+		return game.ID
+	}
+	return ""
+}
+
+func (c *Client) handleMove(payload interface{}) {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
 		return
 	}
 
-	// Validate move
-	if !services.IsValidMove(game, moveData.Column) {
-		c.sendMessage(models.WSMessage{
-			Type: models.MsgTypeInvalidMove,
-			Payload: models.ErrorPayload{
-				Message: "Invalid move",
-			},
-		})
+	data, _ := json.Marshal(payload)
+	var moveData models.MovePayload
+	if err := json.Unmarshal(data, &moveData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid move data")
 		return
 	}
 
-	// Make the move
-	if err := c.service.MakeMove(c.gameID, c.player.ID, moveData.Column); err != nil {
-		c.sendError(err.Error())
+	// The hub sends the update to both players and anyone watching, and a
+	// bot opponent answers on its own
+	number, duplicate, err := c.service.SubmitMove(gameID, c.player.ID, services.MoveRequest{
+		Column: moveData.Column,
+		ID:     moveData.MoveID,
+		Number: moveData.MoveNumber,
+	})
+	if err != nil {
+		c.sendInvalidMove(moveData.MoveID, err)
 		return
 	}
 
-	// Get updated game
-	game = c.service.GetGame(c.gameID)
+	if moveData.MoveID != "" {
+		c.sendMessage(models.WSMessage{
+			Type: models.MsgTypeMoveAck,
+			Payload: models.MoveAckPayload{
+				MoveID:     moveData.MoveID,
+				MoveNumber: number,
+				Duplicate:  duplicate,
+			},
+		})
+	}
+}
 
-	// Send update to both players
+// sendInvalidMove tells the client why a move was refused.
+func (c *Client) sendInvalidMove(moveID string, err error) {
+	payload := errorPayload(err)
+	payload.MoveID = moveID
 	c.sendMessage(models.WSMessage{
-		Type: models.MsgTypeGameUpdate,
-		Payload: models.GameUpdatePayload{
-			Game: game,
-		},
+		Type:    models.MsgTypeInvalidMove,
+		Payload: payload,
 	})
-	c.notifyOpponent(game, models.MsgTypeGameUpdate)
-
-	// Check if game is over
-	if game.State == models.GameStateFinished {
-		winnerName := ""
-		reason := "draw"
-		message := "Game ended in a draw!"
-
-		if game.Winner != nil {
-			winnerName = game.Winner.Username
-			reason = "win"
-			message = winnerName + " wins!"
-		}
+}
 
-		gameOverPayload := models.GameOverPayload{
-			Game:    game,
-			Winner:  winnerName,
-			Reason:  reason,
-			Message: message,
+func (c *Client) handleRequestHint() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
+		return
+	}
+
+	// Working out a hint can take a couple of seconds, so it runs in the
+	// background rather than holding up the client's other messages
+	playerID := c.player.ID
+	go func() {
+		hint, err := c.service.RequestHint(context.Background(), gameID, playerID)
+		if err != nil {
+			c.sendServiceError(err)
+			return
 		}
 
 		c.sendMessage(models.WSMessage{
-			Type:    models.MsgTypeGameOver,
-			Payload: gameOverPayload,
+			Type:    models.MsgTypeHint,
+			Payload: hint,
 		})
-		c.notifyOpponent(game, models.MsgTypeGameOver)
+	}()
+}
 
+func (c *Client) handleResign() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
 		return
 	}
 
-	// If opponent is bot, make bot move
-	if game.Player2.IsBot && game.CurrentTurn == 2 {
-		time.Sleep(time.Duration(500+time.Now().UnixNano()%1000) * time.Millisecond)
-		c.makeBotMove(game)
-	} else if game.Player1.IsBot && game.CurrentTurn == 1 {
-		time.Sleep(time.Duration(500+time.Now().UnixNano()%1000) * time.Millisecond)
-		c.makeBotMove(game)
+	if _, err := c.service.Resign(gameID, c.player.ID); err != nil {
+		c.sendServiceError(err)
 	}
 }
 
-func (c *Client) makeBotMove(game *models.Game) {
-	botPlayerNum := 1
-	if game.Player2.IsBot {
-		botPlayerNum = 2
+func (c *Client) handleOfferDraw() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
+		return
 	}
 
-	bot := services.NewBot(botPlayerNum)
-	column := bot.GetMove(game)
+	agreed, err := c.service.OfferDraw(gameID, c.player.ID)
+	if err == services.ErrDrawDeclined {
+		c.sendMessage(models.WSMessage{
+			Type: models.MsgTypeDrawDeclined,
+			Payload: models.DrawPayload{
+				Message: "The bot declines the draw",
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.sendServiceError(err)
+		return
+	}
 
-	if column == -1 {
+	// An offer crossing the opponent's ends the game, which the hub announces
+	if agreed {
 		return
 	}
+	c.hub.SendToOpponent(c.service.GetGameSnapshot(gameID), c.player.ID, models.WSMessage{
+		Type: models.MsgTypeDrawOffered,
+		Payload: models.DrawPayload{
+			From:    c.player.Username,
+			Message: c.player.Username + " offers a draw",
+		},
+	})
+}
 
-	botID := game.Player1.ID
-	if game.Player2.IsBot {
-		botID = game.Player2.ID
+func (c *Client) handleAcceptDraw() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
+		return
 	}
 
-	// Make bot move
-	c.service.MakeMove(game.ID, botID, column)
+	if _, err := c.service.AcceptDraw(gameID, c.player.ID); err != nil {
+		c.sendServiceError(err)
+	}
+}
 
-	// Get updated game
-	game = c.service.GetGame(game.ID)
+func (c *Client) handleDeclineDraw() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
+		return
+	}
 
-	// Send update
-	c.sendMessage(models.WSMessage{
-		Type: models.MsgTypeGameUpdate,
-		Payload: models.GameUpdatePayload{
-			Game:    game,
-			Message: "Bot made a move",
+	game, err := c.service.DeclineDraw(gameID, c.player.ID)
+	if err != nil {
+		c.sendServiceError(err)
+		return
+	}
+
+	c.hub.SendToOpponent(game, c.player.ID, models.WSMessage{
+		Type: models.MsgTypeDrawDeclined,
+		Payload: models.DrawPayload{
+			From:    c.player.Username,
+			Message: c.player.Username + " declines the draw",
 		},
 	})
+}
 
-	// Check if game is over
-	if game.State == models.GameStateFinished {
-		winnerName := ""
-		reason := "draw"
-		message := "Game ended in a draw!"
-
-		if game.Winner != nil {
-			winnerName = game.Winner.Username
-			reason = "win"
-			message = winnerName + " wins!"
-		}
+func (c *Client) handleAbort() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
+		return
+	}
 
-		c.sendMessage(models.WSMessage{
-			Type: models.MsgTypeGameOver,
-			Payload: models.GameOverPayload{
-				Game:    game,
-				Winner:  winnerName,
-				Reason:  reason,
-				Message: message,
-			},
-		})
+	if _, err := c.service.Abort(gameID, c.player.ID); err != nil {
+		c.sendServiceError(err)
 	}
 }
 
-func (c *Client) handleReconnect(payload interface{}) {
-	data, _ := json.Marshal(payload)
-	var reconnectData models.JoinQueuePayload
-	if err := json.Unmarshal(data, &reconnectData); err != nil {
-		c.sendError("Invalid reconnect data")
+func (c *Client) handleOfferRematch(payload interface{}) {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
 		return
 	}
 
-	// Find game
-	var game *models.Game
-	var playerID string
-
-	// Search for game by ID or username
-	if reconnectData.GameID != "" {
-		game = c.service.GetGame(reconnectData.GameID)
-		if game != nil {
-			if game.Player1.Username == reconnectData.Username {
-				playerID = game.Player1.ID
-			} else if game.Player2 != nil && game.Player2.Username == reconnectData.Username {
-				playerID = game.Player2.ID
-			}
-		}
+	data, _ := json.Marshal(payload)
+	var offerData models.OfferRematchPayload
+	if err := json.Unmarshal(data, &offerData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid rematch data")
+		return
 	}
 
-	if game == nil || playerID == "" {
-		c.sendError("Game not found or already finished")
+	rematch, err := c.service.OfferRematch(gameID, c.player.ID, offerData.BestOf)
+	if err != nil {
+		c.sendServiceError(err)
 		return
 	}
 
-	// Reconnect player
-	if game.Player1.ID == playerID {
-		c.player = game.Player1
-	} else {
-		c.player = game.Player2
+	// Bots accept straight away, as does an opponent who offered first
+	if rematch != nil {
+		c.startRematch(rematch)
+		return
 	}
-	c.gameID = game.ID
-
-	// Register client
-	clientsMutex.Lock()
-	clients[playerID] = c
-	clientsMutex.Unlock()
 
-	// Mark player as reconnected
-	c.service.ReconnectPlayer(playerID)
-
-	// Send current game state
-	c.sendMessage(models.WSMessage{
-		Type: models.MsgTypeGameUpdate,
-		Payload: models.GameUpdatePayload{
-			Game:    game,
-			Message: "Reconnected successfully",
-		},
+	game := c.service.GetGameSnapshot(gameID)
+	if game == nil {
+		return
+	}
+	offered := models.RematchOfferedPayload{
+		From:   c.player.Username,
+		BestOf: offerData.BestOf,
+	}
+	if game.Series != nil && !game.Series.Finished {
+		offered.Series = game.Series
+	}
+	c.hub.SendToOpponent(game, c.player.ID, models.WSMessage{
+		Type:    models.MsgTypeRematchOffered,
+		Payload: offered,
 	})
 }
 
-func (c *Client) handleDisconnect() {
-	if c.player == nil {
+func (c *Client) handleAcceptRematch() {
+	gameID := c.currentGameID()
+	if gameID == "" {
+		c.sendError(models.CodeNotInGame, "Not in a game")
 		return
 	}
 
-	clientsMutex.Lock()
-	delete(clients, c.player.ID)
-	clientsMutex.Unlock()
+	rematch, err := c.service.AcceptRematch(gameID, c.player.ID)
+	if err != nil {
+		c.sendServiceError(err)
+		return
+	}
 
-	// Remove from matchmaking queue
-	c.matchmaking.RemoveFromQueue(c.player.ID)
+	c.startRematch(rematch)
+}
 
-	// Mark as disconnected for reconnection window
-	if c.gameID != "" {
-		game := c.service.GetGame(c.gameID)
-		if game != nil && game.State == models.GameStatePlaying {
-			c.service.MarkPlayerDisconnected(c.player.ID)
-			c.notifyOpponent(game, models.MsgTypeOpponentLeft)
-		}
+// startRematch takes both players out of the queue and any room they were
+// waiting in. The hub has already sent game_start.
+func (c *Client) startRematch(game *models.Game) {
+	for _, player := range []*models.Player{game.Player1, game.Player2} {
+		c.matchmaking.RemoveFromQueue(player.ID)
+		c.rooms.CloseRoomsHostedBy(player.ID)
 	}
 }
 
-func (c *Client) notifyOpponent(game *models.Game, msgType models.MessageType) {
-	if game == nil {
+// handleReconnect puts a player back into their game. The session token
+// from game_start proves who they are; it is used up, and a new one comes
+// back with the game state, after any messages the player missed.
+func (c *Client) handleReconnect(payload interface{}) {
+	data, _ := json.Marshal(payload)
+	var reconnectData models.JoinQueuePayload
+	if err := json.Unmarshal(data, &reconnectData); err != nil {
+		c.sendError(models.CodeInvalidPayload, "Invalid reconnect data")
 		return
 	}
 
-	var opponentID string
-	if c.player.ID == game.Player1.ID && game.Player2 != nil {
-		if game.Player2.IsBot {
-			return
-		}
-		opponentID = game.Player2.ID
-	} else if game.Player1 != nil {
-		if game.Player1.IsBot {
-			return
-		}
-		opponentID = game.Player1.ID
+	if reconnectData.SessionToken == "" {
+		c.sendError(models.CodeSessionRequired, "Session token required to reconnect")
+		return
 	}
 
-	if opponentID == "" {
+	game, player, token, err := c.service.ResumeSession(reconnectData.SessionToken)
+	if err == nil && reconnectData.GameID != "" && reconnectData.GameID != game.ID {
+		err = services.ErrInvalidSession
+	}
+	if err != nil {
+		c.sendServiceError(err)
 		return
 	}
 
-	clientsMutex.RLock()
-	opponent := clients[opponentID]
-	clientsMutex.RUnlock()
+	// Reconnect player
+	if c.player != nil && c.player.ID != player.ID {
+		c.matchmaking.RemoveFromQueue(c.player.ID)
+		c.rooms.CloseRoomsHostedBy(c.player.ID)
+	}
+	c.hub.Leave(c)
+	c.player = player
+
+	// Catch the player up on what they missed
+	c.hub.Rejoin(c, player.ID, game, reconnectData.LastSeq, token)
+
+	// Mark player as reconnected
+	c.service.ReconnectPlayer(player.ID)
+}
 
-	if opponent == nil {
+func (c *Client) handleDisconnect() {
+	c.hub.Leave(c)
+
+	if c.player == nil {
 		return
 	}
 
-	var payload interface{}
-	switch msgType {
-	case models.MsgTypeGameStart:
-		payload = models.GameStartPayload{
-			Game:         game,
-			YourPlayerID: opponentID,
-		}
-	case models.MsgTypeGameUpdate:
-		payload = models.GameUpdatePayload{
-			Game: game,
-		}
-	case models.MsgTypeGameOver:
-		winnerName := ""
-		reason := "draw"
-		message := "Game ended in a draw!"
-
-		if game.Winner != nil {
-			winnerName = game.Winner.Username
-			reason = "win"
-			message = winnerName + " wins!"
-		}
+	// Remove from matchmaking queue and close any room waiting for a friend
+	c.matchmaking.RemoveFromQueue(c.player.ID)
+	c.rooms.CloseRoomsHostedBy(c.player.ID)
 
-		payload = models.GameOverPayload{
-			Game:    game,
-			Winner:  winnerName,
-			Reason:  reason,
-			Message: message,
-		}
-	case models.MsgTypeOpponentLeft:
-		payload = models.ErrorPayload{
-			Message: "Opponent disconnected. They have 30 seconds to reconnect.",
-		}
+	// Mark as disconnected for reconnection window
+	if game := c.currentGame(); game != nil && game.State == models.GameStatePlaying {
+		c.service.MarkPlayerDisconnected(c.player.ID)
+		c.hub.SendToOpponent(game, c.player.ID, models.WSMessage{
+			Type: models.MsgTypeOpponentLeft,
+			Payload: models.OpponentLeftPayload{
+				Message: "Opponent disconnected. They have 30 seconds to reconnect.",
+			},
+		})
 	}
-
-	opponent.sendMessage(models.WSMessage{
-		Type:    msgType,
-		Payload: payload,
-	})
 }
 
 func (c *Client) sendMessage(msg models.WSMessage) {
@@ -512,15 +587,73 @@ func (c *Client) sendMessage(msg models.WSMessage) {
 	select {
 	case c.send <- data:
 	default:
-		log.Println("Client send buffer full")
+		// Rather than lose messages, drop a client that can't keep up. It
+		// can reconnect and catch up from its last seq.
+		c.closeOnce.Do(func() {
+			log.Println("Client send buffer full, disconnecting")
+			c.conn.Close()
+		})
 	}
 }
 
-func (c *Client) sendError(message string) {
+func (c *Client) sendError(code string, message string) {
 	c.sendMessage(models.WSMessage{
 		Type: models.MsgTypeError,
 		Payload: models.ErrorPayload{
 			Message: message,
+			Code:    code,
 		},
 	})
 }
+
+// sendServiceError sends an error returned by one of the services, with
+// the code that goes with it.
+func (c *Client) sendServiceError(err error) {
+	c.sendMessage(models.WSMessage{
+		Type:    models.MsgTypeError,
+		Payload: errorPayload(err),
+	})
+}
+
+func gameUpdatePayload(game *models.Game, message string) models.GameUpdatePayload {
+	payload := models.GameUpdatePayload{
+		Game:    game,
+		Message: message,
+	}
+
+	if game.Clock != nil {
+		left := services.TimeLeft(game, time.Now())
+		payload.TimeLeftMs = &[2]int64{left[0].Milliseconds(), left[1].Milliseconds()}
+	}
+	return payload
+}
+
+func gameOverPayload(game *models.Game) models.GameOverPayload {
+	payload := models.GameOverPayload{
+		Game:    game,
+		Reason:  game.EndReason,
+		Message: "Game ended in a draw!",
+	}
+
+	switch game.EndReason {
+	case models.ReasonDrawAgreed:
+		payload.Message = "Draw agreed"
+	case models.ReasonAborted:
+		payload.Message = "Game aborted"
+	}
+
+	if game.Winner != nil {
+		payload.Winner = game.Winner.Username
+		switch game.EndReason {
+		case models.ReasonTimeout:
+			payload.Message = payload.Winner + " wins on time!"
+		case models.ReasonForfeit:
+			payload.Message = payload.Winner + " wins, opponent left"
+		case models.ReasonResign:
+			payload.Message = payload.Winner + " wins by resignation"
+		default:
+			payload.Message = payload.Winner + " wins!"
+		}
+	}
+	return payload
+}
@@ -48,7 +48,12 @@ func main() {
 
 	// Initialize services
 	gameService := services.NewGameService(db, kafkaBrokers)
-	matchmakingService := services.NewMatchmakingService(gameService)
+	matchmakingService := services.NewMatchmakingService(gameService, gameService.Ratings(), services.SystemClock)
+	roomService := services.NewRoomService(gameService, services.SystemClock)
+
+	// Deliver game events to connected clients
+	hub := handlers.NewHub(gameService)
+	go hub.Run()
 
 	// Start matchmaking loop
 	go matchmakingService.StartMatchmaking()
@@ -56,11 +61,14 @@ func main() {
 	// Set up HTTP handlers
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handlers.HandleWebSocket(w, r, gameService, matchmakingService)
+		handlers.HandleWebSocket(w, r, hub, gameService, matchmakingService, roomService)
 	})
 	mux.HandleFunc("/api/leaderboard", func(w http.ResponseWriter, r *http.Request) {
 		handlers.HandleLeaderboard(w, r, gameService)
 	})
+	mux.HandleFunc("/api/games/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleGames(w, r, gameService, hub)
+	})
 	mux.HandleFunc("/api/analytics", func(w http.ResponseWriter, r *http.Request) {
 		handlers.HandleAnalytics(w, r, db)
 	})
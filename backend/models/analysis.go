@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// MoveQuality grades a move against the best move in the same position.
+type MoveQuality string
+
+const (
+	MoveBest       MoveQuality = "best"
+	MoveInaccuracy MoveQuality = "inaccuracy" // same result, but slower or less convincing
+	MoveMistake    MoveQuality = "mistake"    // gave away a win or a clear edge
+	MoveBlunder    MoveQuality = "blunder"    // turned a win or draw into a loss
+)
+
+// MoveAnalysis compares a move with the best one available. Outcomes and
+// scores are from the point of view of the player making the move.
+type MoveAnalysis struct {
+	Number      int         `json:"number"`
+	PlayerNum   int         `json:"playerNum"`
+	Column      int         `json:"column"`
+	Outcome     string      `json:"outcome"`
+	Score       int         `json:"score"`
+	BestColumn  int         `json:"bestColumn"`
+	BestOutcome string      `json:"bestOutcome"`
+	BestScore   int         `json:"bestScore"`
+	Quality     MoveQuality `json:"quality"`
+	Exact       bool        `json:"exact"` // solved rather than estimated
+}
+
+// MoveSummary counts one player's moves by quality.
+type MoveSummary struct {
+	Best         int `json:"best"`
+	Inaccuracies int `json:"inaccuracies"`
+	Mistakes     int `json:"mistakes"`
+	Blunders     int `json:"blunders"`
+}
+
+// GameAnalysis is the post-game report for a finished game.
+type GameAnalysis struct {
+	GameID       string         `json:"gameId"`
+	Variant      string         `json:"variant"`
+	Moves        []MoveAnalysis `json:"moves"`
+	Summary      [2]MoveSummary `json:"summary"`                // indexed by player number - 1
+	TurningPoint int            `json:"turningPoint,omitempty"` // move number after which the result was decided
+	AnalyzedAt   time.Time      `json:"analyzedAt"`
+}
@@ -1,18 +1,77 @@
 package models
 
 import (
+	"connect-four-backend/engine"
 	"time"
 )
 
-const (
-	Rows    = 6
-	Columns = 7
+// Rules describes the board a game is played on and how many discs in a
+// row are needed to win.
+type Rules struct {
+	Variant  string `json:"variant"`
+	Columns  int    `json:"columns"`
+	Rows     int    `json:"rows"`
+	ConnectN int    `json:"connectN"`
+}
+
+var (
+	RulesStandard = Rules{Variant: "standard", Columns: 7, Rows: 6, ConnectN: 4}
+	Rules8x7      = Rules{Variant: "8x7", Columns: 8, Rows: 7, ConnectN: 4}
+	Rules9x7      = Rules{Variant: "9x7", Columns: 9, Rows: 7, ConnectN: 4}
+	RulesConnect5 = Rules{Variant: "connect5", Columns: 9, Rows: 6, ConnectN: 5}
 )
 
+// Variants lists the rule presets players can choose from, keyed by name.
+var Variants = map[string]Rules{
+	RulesStandard.Variant: RulesStandard,
+	Rules8x7.Variant:      Rules8x7,
+	Rules9x7.Variant:      Rules9x7,
+	RulesConnect5.Variant: RulesConnect5,
+}
+
+// RulesForVariant returns the preset for the given variant name. An empty
+// name selects the standard 7x6 connect-four rules.
+func RulesForVariant(name string) (Rules, bool) {
+	if name == "" {
+		return RulesStandard, true
+	}
+	rules, ok := Variants[name]
+	return rules, ok
+}
+
 type Player struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	IsBot    bool   `json:"isBot"`
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	IsBot    bool     `json:"isBot"`
+	Bot      *BotSpec `json:"bot,omitempty"` // set for bot players
+}
+
+// BotSpec records which bot implementation plays for a bot player and with
+// what settings. Name is a key in the services bot registry.
+type BotSpec struct {
+	Name     string            `json:"name"`
+	Level    BotLevel          `json:"level,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// BotLevel is the difficulty a bot player plays at.
+type BotLevel string
+
+const (
+	BotLevelEasy    BotLevel = "easy"
+	BotLevelMedium  BotLevel = "medium"
+	BotLevelHard    BotLevel = "hard"
+	BotLevelPerfect BotLevel = "perfect"
+)
+
+// ParseBotLevel validates a difficulty name. An empty name is accepted and
+// returned as is, meaning "choose for me".
+func ParseBotLevel(name string) (BotLevel, bool) {
+	switch level := BotLevel(name); level {
+	case "", BotLevelEasy, BotLevelMedium, BotLevelHard, BotLevelPerfect:
+		return level, true
+	}
+	return "", false
 }
 
 type GameState string
@@ -24,24 +83,83 @@ const (
 )
 
 type Game struct {
-	ID          string     `json:"id"`
-	Player1     *Player    `json:"player1"`
-	Player2     *Player    `json:"player2"`
-	Board       [][]int    `json:"board"` // 0 = empty, 1 = player1, 2 = player2
-	CurrentTurn int        `json:"currentTurn"`
-	State       GameState  `json:"state"`
-	Winner      *Player    `json:"winner,omitempty"`
-	WinningLine [][]int    `json:"winningLine,omitempty"`
-	StartTime   time.Time  `json:"startTime"`
-	EndTime     *time.Time `json:"endTime,omitempty"`
-	LastMoveCol *int       `json:"lastMoveCol,omitempty"`
-	LastMoveRow *int       `json:"lastMoveRow,omitempty"`
+	ID          string      `json:"id"`
+	Rules       Rules       `json:"rules"`
+	Player1     *Player     `json:"player1"`
+	Player2     *Player     `json:"player2"`
+	Board       [][]int     `json:"board"` // 0 = empty, 1 = player1, 2 = player2
+	CurrentTurn int         `json:"currentTurn"`
+	State       GameState   `json:"state"`
+	Winner      *Player     `json:"winner,omitempty"`
+	WinningLine [][]int     `json:"winningLine,omitempty"`
+	StartTime   time.Time   `json:"startTime"`
+	EndTime     *time.Time  `json:"endTime,omitempty"`
+	LastMoveCol *int        `json:"lastMoveCol,omitempty"`
+	LastMoveRow *int        `json:"lastMoveRow,omitempty"`
+	Moves       []Move      `json:"moves"`
+	Rated       bool        `json:"rated"`
+	Hints       HintQuota   `json:"hints"`
+	Series      *Series     `json:"series,omitempty"`
+	TimeControl TimeControl `json:"timeControl"`
+	Clock       *GameClock  `json:"clock,omitempty"` // set for timed games once they start
+	EndReason   string      `json:"endReason,omitempty"`
+	DrawOffer   int         `json:"drawOffer,omitempty"` // player number with a draw offer pending
+	Sessions    [2]string   `json:"-"`                   // each player's current session, never sent to clients
+
+	// Position mirrors Board as a bitboard, on boards small enough for one.
+	// services.MakeMove keeps the two in step.
+	Position engine.Position `json:"-"`
+}
+
+// Series is a best-of-N match between two players. Every game in the
+// series points to the same Series, which keeps the running score.
+type Series struct {
+	ID       string     `json:"id"`
+	BestOf   int        `json:"bestOf"`
+	Players  [2]*Player `json:"players"` // in their order in the first game
+	Wins     [2]int     `json:"wins"`    // indexed like Players
+	Draws    int        `json:"draws"`
+	GameIDs  []string   `json:"gameIds"`
+	Winner   *Player    `json:"winner,omitempty"`
+	Finished bool       `json:"finished"`
 }
 
+// IsValidBestOf reports whether n is a supported series length. Zero and
+// one mean a single game.
+func IsValidBestOf(n int) bool {
+	switch n {
+	case 0, 1, 3, 5:
+		return true
+	}
+	return false
+}
+
+// HintQuota tracks how many hints each player may still ask for. Rated
+// games have a limit of 0, which turns hints off.
+type HintQuota struct {
+	Limit    int     `json:"limit"` // per player
+	Used     [2]int  `json:"used"`  // indexed by player number - 1
+	Pending  [2]bool `json:"-"`     // hint taken since the player's last move
+	Thinking [2]bool `json:"-"`     // hint being worked out
+}
+
+// Remaining returns how many hints the given player has left.
+func (q HintQuota) Remaining(playerNum int) int {
+	if left := q.Limit - q.Used[playerNum-1]; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Move is one disc drop in a game's history.
 type Move struct {
+	Number    int       `json:"number"` // 1-based
 	Column    int       `json:"column"`
+	Row       int       `json:"row"`
+	PlayerNum int       `json:"playerNum"`
 	PlayerID  string    `json:"playerId"`
 	Timestamp time.Time `json:"timestamp"`
+	HintUsed  bool      `json:"hintUsed,omitempty"` // player asked for a hint before this move
 }
 
 type GameResult struct {
@@ -54,25 +172,67 @@ type GameResult struct {
 	CompletedAt  time.Time `json:"completedAt"`
 	Player1IsBot bool      `json:"player1IsBot"`
 	Player2IsBot bool      `json:"player2IsBot"`
+	Variant      string    `json:"variant"`
+	BotLevel     BotLevel  `json:"botLevel,omitempty"`
+	BotName      string    `json:"botName,omitempty"`
+	Moves        []Move    `json:"moves"`
+}
+
+// LiveGame summarises a game in progress for the list of games people can
+// watch.
+type LiveGame struct {
+	ID          string      `json:"id"`
+	Rules       Rules       `json:"rules"`
+	Player1     *Player     `json:"player1"`
+	Player2     *Player     `json:"player2"`
+	Rated       bool        `json:"rated"`
+	TimeControl TimeControl `json:"timeControl"`
+	MoveCount   int         `json:"moveCount"`
+	StartTime   time.Time   `json:"startTime"`
+	Spectators  int         `json:"spectators"`
 }
 
 type LeaderboardEntry struct {
-	Username string `json:"username"`
-	Wins     int    `json:"wins"`
-	Losses   int    `json:"losses"`
-	Draws    int    `json:"draws"`
+	Username    string        `json:"username"`
+	Wins        int           `json:"wins"`
+	Losses      int           `json:"losses"`
+	Draws       int           `json:"draws"`
+	Rating      float64       `json:"rating"`
+	Deviation   float64       `json:"deviation"`
+	Volatility  float64       `json:"volatility"`
+	Provisional bool          `json:"provisional"`
+	History     []RatingPoint `json:"history"` // oldest first
+}
+
+// Rating is a Glicko-2 rating on the familiar Elo-like scale.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+// RatingPoint is a player's rating after a rated game.
+type RatingPoint struct {
+	GameID     string    `json:"gameId"`
+	Rating     float64   `json:"rating"`
+	Deviation  float64   `json:"deviation"`
+	RecordedAt time.Time `json:"recordedAt"`
 }
 
-func NewGame(player1 *Player) *Game {
-	board := make([][]int, Rows)
+func NewGame(player1 *Player, rules Rules) *Game {
+	board := make([][]int, rules.Rows)
 	for i := range board {
-		board[i] = make([]int, Columns)
+		board[i] = make([]int, rules.Columns)
 	}
+	position, _ := engine.New(rules.Columns, rules.Rows, rules.ConnectN)
 
 	return &Game{
 		ID:          generateGameID(),
+		Rules:       rules,
 		Player1:     player1,
 		Board:       board,
+		Position:    position,
+		Moves:       []Move{},
 		CurrentTurn: 1,
 		State:       GameStateWaiting,
 		StartTime:   time.Now(),
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 type MessageType string
 
 const (
@@ -7,41 +11,216 @@ const (
 	MsgTypeGameStart    MessageType = "game_start"
 	MsgTypeGameUpdate   MessageType = "game_update"
 	MsgTypeMove         MessageType = "move"
+	MsgTypeMoveAck      MessageType = "move_ack"
 	MsgTypeGameOver     MessageType = "game_over"
 	MsgTypeError        MessageType = "error"
 	MsgTypeReconnect    MessageType = "reconnect"
 	MsgTypeOpponentLeft MessageType = "opponent_left"
 	MsgTypeInvalidMove  MessageType = "invalid_move"
+	MsgTypeRequestHint  MessageType = "request_hint"
+	MsgTypeHint         MessageType = "hint"
+	MsgTypeCreateRoom   MessageType = "create_room"
+	MsgTypeRoomCreated  MessageType = "room_created"
+	MsgTypeJoinRoom     MessageType = "join_room"
+
+	MsgTypeOfferRematch   MessageType = "offer_rematch"
+	MsgTypeRematchOffered MessageType = "rematch_offered"
+	MsgTypeAcceptRematch  MessageType = "accept_rematch"
+
+	MsgTypeResign       MessageType = "resign"
+	MsgTypeOfferDraw    MessageType = "offer_draw"
+	MsgTypeDrawOffered  MessageType = "draw_offered"
+	MsgTypeAcceptDraw   MessageType = "accept_draw"
+	MsgTypeDeclineDraw  MessageType = "decline_draw"
+	MsgTypeDrawDeclined MessageType = "draw_declined"
+	MsgTypeAbort        MessageType = "abort"
+
+	MsgTypeSpectate   MessageType = "spectate"
+	MsgTypeSpectators MessageType = "spectators"
 )
 
 type WSMessage struct {
 	Type    MessageType `json:"type"`
 	Payload interface{} `json:"payload"`
+
+	// Set on messages about a game. Seq counts up from 1 for each game.
+	GameID string `json:"gameId,omitempty"`
+	Seq    int64  `json:"seq,omitempty"`
 }
 
 type JoinQueuePayload struct {
+	Username     string `json:"username"`
+	GameID       string `json:"gameId,omitempty"`       // for reconnection
+	SessionToken string `json:"sessionToken,omitempty"` // for reconnection, from game_start
+	LastSeq      int64  `json:"lastSeq,omitempty"`      // for reconnection, the last seq received
+	Variant      string `json:"variant,omitempty"`      // board preset, defaults to standard
+	BotLevel     string `json:"botLevel,omitempty"`     // bot difficulty if no opponent is found
+	Casual       bool   `json:"casual,omitempty"`       // unrated game with hints allowed
+
+	TimeControl TimeControl `json:"timeControl"` // omitted for an untimed game
+}
+
+type CreateRoomPayload struct {
 	Username string `json:"username"`
-	GameID   string `json:"gameId,omitempty"` // for reconnection
+	Variant  string `json:"variant,omitempty"`
+	Casual   bool   `json:"casual,omitempty"` // unrated game with hints allowed
+	BestOf   int    `json:"bestOf,omitempty"` // 3 or 5 to play a series
+
+	TimeControl TimeControl `json:"timeControl"` // omitted for an untimed game
+}
+
+type RoomCreatedPayload struct {
+	Code      string    `json:"code"`
+	Rules     Rules     `json:"rules"`
+	Rated     bool      `json:"rated"`
+	BestOf    int       `json:"bestOf,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	TimeControl TimeControl `json:"timeControl"`
+}
+
+type JoinRoomPayload struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
+
+type SpectatePayload struct {
+	GameID string `json:"gameId"`
+}
+
+// SpectatorsPayload is sent to everyone on a game when the number of
+// people watching it changes.
+type SpectatorsPayload struct {
+	GameID string `json:"gameId"`
+	Count  int    `json:"count"`
+}
+
+type OfferRematchPayload struct {
+	BestOf int `json:"bestOf,omitempty"` // 3 or 5 to start a series
+}
+
+type RematchOfferedPayload struct {
+	From   string  `json:"from"` // username of the player offering
+	BestOf int     `json:"bestOf,omitempty"`
+	Series *Series `json:"series,omitempty"` // the series a rematch would continue
 }
 
 type MovePayload struct {
-	Column int `json:"column"`
+	Column     int    `json:"column"`
+	MoveID     string `json:"moveId,omitempty"`     // chosen by the client; a retry with the same ID isn't played twice
+	MoveNumber int    `json:"moveNumber,omitempty"` // number the move will have, 1-based; rejected as stale if the game has moved on
+}
+
+// DrawPayload tells a player their opponent offers a draw, or declines
+// theirs.
+type DrawPayload struct {
+	From    string `json:"from,omitempty"` // username of the opponent; left out for bots
+	Message string `json:"message"`
+}
+
+// OpponentLeftPayload tells a player their opponent disconnected.
+type OpponentLeftPayload struct {
+	Message string `json:"message"`
+}
+
+// MoveAckPayload confirms a move sent with a move ID.
+type MoveAckPayload struct {
+	MoveID     string `json:"moveId"`
+	MoveNumber int    `json:"moveNumber"`
+	Duplicate  bool   `json:"duplicate,omitempty"` // the move had already been played
 }
 
+// HintPayload answers a hint request. Evaluations are from the point of
+// view of the player asking, one per playable column.
+type HintPayload struct {
+	Column      int                `json:"column"`
+	Evaluations []ColumnEvaluation `json:"evaluations"`
+	Exact       bool               `json:"exact"` // solved rather than estimated
+	HintsLeft   int                `json:"hintsLeft"`
+}
+
+// ColumnEvaluation is the value of playing a column. Outcome is "win",
+// "loss", "draw" or, when the search couldn't see to the end of the game,
+// "unclear". Higher scores are better; exact scores count how early the
+// game is won or lost, estimated ones are heuristic.
+type ColumnEvaluation struct {
+	Column  int    `json:"column"`
+	Outcome string `json:"outcome"`
+	Score   int    `json:"score"`
+}
+
+// Error codes given in ErrorPayload. Codes don't change, so clients can
+// act on them and show messages of their own; the message is in English.
+const (
+	CodeInvalidPayload     = "invalid_payload" // the payload couldn't be read
+	CodeUnknownVariant     = "unknown_variant"
+	CodeUnknownBotLevel    = "unknown_bot_level"
+	CodeInvalidTimeControl = "invalid_time_control"
+	CodeInternal           = "internal_error"
+
+	CodeGameNotFound   = "game_not_found"
+	CodeNotInGame      = "not_in_game"
+	CodeAlreadyPlaying = "already_playing" // can't spectate during a game of your own
+	CodeGameOver       = "game_over"
+	CodeGamePaused     = "game_paused" // waiting for players to reconnect
+	CodeGameInProgress = "game_in_progress"
+
+	CodeNotYourTurn   = "not_your_turn"
+	CodeInvalidColumn = "invalid_column"
+	CodeColumnFull    = "column_full"
+	CodeStaleMove     = "stale_move"
+	CodeOutOfTime     = "out_of_time"
+
+	CodeHintsDisabled  = "hints_disabled"
+	CodeNoHintsLeft    = "no_hints_left"
+	CodeHintPending    = "hint_pending" // the last hint asked for isn't ready yet
+	CodeStaleHint      = "stale_hint"
+	CodeNoValidMove    = "no_valid_move" // the board is full
+	CodeNoDrawOffer    = "no_draw_offer"
+	CodeTooLateToAbort = "too_late_to_abort"
+
+	CodeInvalidSeries      = "invalid_series"
+	CodeNoRematchOffer     = "no_rematch_offer"
+	CodeRematchUnavailable = "rematch_unavailable"
+	CodeRoomNotFound       = "room_not_found"
+	CodeOwnRoom            = "own_room"
+
+	CodeSessionRequired = "session_required"
+	CodeInvalidSession  = "invalid_session"
+)
+
 type ErrorPayload struct {
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+	MoveID  string `json:"moveId,omitempty"` // the move rejected, if it had an ID
 }
 
 type GameStartPayload struct {
 	Game         *Game  `json:"game"`
 	YourPlayerID string `json:"yourPlayerId"`
+	SessionToken string `json:"sessionToken"` // needed to reconnect to this game
 }
 
 type GameUpdatePayload struct {
-	Game    *Game  `json:"game"`
-	Message string `json:"message,omitempty"`
+	Game       *Game     `json:"game"`
+	Message    string    `json:"message,omitempty"`
+	TimeLeftMs *[2]int64 `json:"timeLeftMs,omitempty"` // both players' time left when sent, in timed games
+
+	SessionToken string `json:"sessionToken,omitempty"` // replaces the token used to reconnect
 }
 
+// Reasons a game ended, as given in GameOverPayload.
+const (
+	ReasonWin     = "win"
+	ReasonDraw    = "draw"
+	ReasonForfeit = "forfeit" // the loser disconnected and didn't come back
+	ReasonTimeout = "timeout" // the loser ran out of time
+
+	ReasonResign     = "resign"
+	ReasonDrawAgreed = "draw_agreed"
+	ReasonAborted    = "aborted" // called off before both players moved; counts for nobody
+)
+
 type GameOverPayload struct {
 	Game    *Game  `json:"game"`
 	Winner  string `json:"winner,omitempty"`
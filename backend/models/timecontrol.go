@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits on time controls players can ask for, in seconds.
+const (
+	maxBaseTime  = 60 * 60
+	maxIncrement = 60
+	minMoveTime  = 5
+	maxMoveTime  = 10 * 60
+)
+
+// TimeControl limits how long each player may think. A player either has a
+// bank of Base seconds that gains Increment seconds after each of their
+// moves, or PerMove seconds for every move, with nothing carried over. The
+// zero value is an untimed game.
+type TimeControl struct {
+	Base      int `json:"base,omitempty"`
+	Increment int `json:"increment,omitempty"`
+	PerMove   int `json:"perMove,omitempty"`
+}
+
+// Untimed reports whether the time control sets no limit.
+func (tc TimeControl) Untimed() bool {
+	return tc == TimeControl{}
+}
+
+// Valid reports whether the time control is one of the kinds above and
+// within limits.
+func (tc TimeControl) Valid() bool {
+	if tc.PerMove != 0 {
+		return tc.Base == 0 && tc.Increment == 0 && tc.PerMove >= minMoveTime && tc.PerMove <= maxMoveTime
+	}
+	if tc.Increment != 0 && tc.Base == 0 {
+		return false
+	}
+	return tc.Base >= 0 && tc.Base <= maxBaseTime && tc.Increment >= 0 && tc.Increment <= maxIncrement
+}
+
+// String gives the time control in the usual short form: "3+2" for three
+// minutes plus two seconds a move, "30s/move", or "" when untimed.
+func (tc TimeControl) String() string {
+	switch {
+	case tc.PerMove > 0:
+		return fmt.Sprintf("%ds/move", tc.PerMove)
+	case tc.Base%60 == 0 && tc.Base > 0:
+		return fmt.Sprintf("%d+%d", tc.Base/60, tc.Increment)
+	case tc.Base > 0:
+		return fmt.Sprintf("%ds+%d", tc.Base, tc.Increment)
+	}
+	return ""
+}
+
+// GameClock is the time the players of a timed game have left. The player
+// to move has been thinking since TurnStartedAt, which isn't taken off
+// their time until they move.
+type GameClock struct {
+	RemainingMs   [2]int64  `json:"remainingMs"` // indexed by player number - 1
+	TurnStartedAt time.Time `json:"turnStartedAt"`
+}
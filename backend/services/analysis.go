@@ -0,0 +1,345 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"connect-four-backend/solver"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// analysisThinkTime bounds the solver for each position of a game under
+	// analysis. Positions it can't solve in time are estimated instead.
+	analysisThinkTime = time.Second
+
+	// analysisQueueSize is how many finished games can wait for analysis.
+	// Games that don't fit are analysed when someone asks for the report.
+	analysisQueueSize = 64
+
+	// Score drops that make an estimated move an inaccuracy or a mistake.
+	// Estimated scores come from the lookahead search's window count.
+	inaccuracyMargin = 4
+	mistakeMargin    = 12
+)
+
+var ErrAnalysisPending = errors.New("analysis not ready yet")
+
+// AnalysisService replays finished games in the background, grades every
+// move and caches the report in the database. It has its own solver, so
+// analysis doesn't hold up bots or hints.
+type AnalysisService struct {
+	db     *sql.DB
+	solver *solver.Solver
+	queue  chan *models.Game
+
+	mu      sync.Mutex
+	pending map[string]bool // game IDs queued or being analysed
+}
+
+// NewAnalysisService starts the analysis worker. book may be nil.
+func NewAnalysisService(db *sql.DB, book *solver.Book) *AnalysisService {
+	as := &AnalysisService{
+		db:      db,
+		solver:  solver.New(0),
+		queue:   make(chan *models.Game, analysisQueueSize),
+		pending: make(map[string]bool),
+	}
+	as.solver.SetBook(book)
+
+	go as.run()
+
+	return as
+}
+
+// Enqueue schedules a finished game for analysis. The game must not change
+// afterwards; pass a copy of a live game.
+func (as *AnalysisService) Enqueue(game *models.Game) {
+	if len(game.Moves) == 0 {
+		return
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.pending[game.ID] {
+		return
+	}
+
+	select {
+	case as.queue <- game:
+		as.pending[game.ID] = true
+	default:
+		log.Printf("Analysis queue full, skipping game %s for now", game.ID)
+	}
+}
+
+// GetAnalysis returns the cached report for a game. If there is none yet
+// but the game has been saved, it is queued and ErrAnalysisPending is
+// returned; unknown games give ErrGameNotFound.
+func (as *AnalysisService) GetAnalysis(gameID string) (*models.GameAnalysis, error) {
+	var report []byte
+	err := as.db.QueryRow("SELECT report FROM game_analysis WHERE game_id = $1", gameID).Scan(&report)
+	if err == nil {
+		var analysis models.GameAnalysis
+		if err := json.Unmarshal(report, &analysis); err != nil {
+			return nil, err
+		}
+		return &analysis, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	as.mu.Lock()
+	pending := as.pending[gameID]
+	as.mu.Unlock()
+	if pending {
+		return nil, ErrAnalysisPending
+	}
+
+	game, err := as.loadGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+	as.Enqueue(game)
+	return nil, ErrAnalysisPending
+}
+
+func (as *AnalysisService) run() {
+	for game := range as.queue {
+		start := time.Now()
+		analysis, err := AnalyzeGame(context.Background(), game, as.solver, analysisThinkTime)
+		if err != nil {
+			log.Printf("Failed to analyse game %s: %v", game.ID, err)
+		} else if err := as.save(analysis); err != nil {
+			log.Printf("Failed to save analysis for game %s: %v", game.ID, err)
+		} else {
+			log.Printf("Analysed game %s in %v", game.ID, time.Since(start).Round(time.Millisecond))
+		}
+
+		as.mu.Lock()
+		delete(as.pending, game.ID)
+		as.mu.Unlock()
+	}
+}
+
+func (as *AnalysisService) save(analysis *models.GameAnalysis) error {
+	report, err := json.Marshal(analysis)
+	if err != nil {
+		return err
+	}
+
+	_, err = as.db.Exec(`
+		INSERT INTO game_analysis (game_id, report, analyzed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (game_id) DO UPDATE
+		SET report = $2, analyzed_at = $3
+	`, analysis.GameID, string(report), analysis.AnalyzedAt)
+	return err
+}
+
+// loadGame rebuilds a saved game from the games table, with enough detail
+// to analyse it.
+func (as *AnalysisService) loadGame(gameID string) (*models.Game, error) {
+	var player1, player2, winner, variant string
+	var player1IsBot, player2IsBot bool
+	var moves []byte
+
+	err := as.db.QueryRow(`
+		SELECT player1, player2, COALESCE(winner, ''), variant, moves, player1_is_bot, player2_is_bot
+		FROM games WHERE id = $1
+	`, gameID).Scan(&player1, &player2, &winner, &variant, &moves, &player1IsBot, &player2IsBot)
+	if err == sql.ErrNoRows {
+		return nil, ErrGameNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules, ok := models.RulesForVariant(variant)
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+
+	game := models.NewGame(&models.Player{Username: player1, IsBot: player1IsBot}, rules)
+	game.ID = gameID
+	game.Player2 = &models.Player{Username: player2, IsBot: player2IsBot}
+	game.State = models.GameStateFinished
+	if err := json.Unmarshal(moves, &game.Moves); err != nil {
+		return nil, err
+	}
+
+	switch winner {
+	case "":
+	case player1:
+		game.Winner = game.Player1
+	case player2:
+		game.Winner = game.Player2
+	}
+
+	return game, nil
+}
+
+// AnalyzeGame replays a game and grades each move by how much worse it was
+// than the best move in the same position. Positions are evaluated from the
+// last move back, so the solver's table is warm by the time it reaches the
+// harder early positions.
+func AnalyzeGame(ctx context.Context, game *models.Game, s *solver.Solver, thinkTime time.Duration) (*models.GameAnalysis, error) {
+	// Rebuild the position before every move
+	replay := CloneGame(game)
+	for _, row := range replay.Board {
+		for col := range row {
+			row[col] = 0
+		}
+	}
+	replay.Moves = nil
+	replay.CurrentTurn = 1
+
+	positions := make([]*models.Game, len(game.Moves))
+	for i, move := range game.Moves {
+		positions[i] = CloneGame(replay)
+		if _, err := MakeMove(replay, move.Column, move.PlayerNum); err != nil {
+			return nil, err
+		}
+		replay.CurrentTurn = 3 - move.PlayerNum
+	}
+
+	analysis := &models.GameAnalysis{
+		GameID:  game.ID,
+		Variant: game.Rules.Variant,
+		Moves:   make([]models.MoveAnalysis, len(game.Moves)),
+	}
+
+	for i := len(positions) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		move := game.Moves[i]
+		eval, err := evaluateMoves(ctx, positions[i], s, thinkTime)
+		if err != nil {
+			return nil, err
+		}
+
+		ma := models.MoveAnalysis{
+			Number:     move.Number,
+			PlayerNum:  move.PlayerNum,
+			Column:     move.Column,
+			BestColumn: eval.Column,
+			Exact:      eval.Exact,
+		}
+		for _, e := range eval.Evaluations {
+			if e.Column == move.Column {
+				ma.Outcome, ma.Score = e.Outcome, e.Score
+			}
+			if e.Column == eval.Column {
+				ma.BestOutcome, ma.BestScore = e.Outcome, e.Score
+			}
+		}
+		ma.Quality = gradeMove(ma)
+		analysis.Moves[i] = ma
+
+		summary := &analysis.Summary[move.PlayerNum-1]
+		switch ma.Quality {
+		case models.MoveBest:
+			summary.Best++
+		case models.MoveInaccuracy:
+			summary.Inaccuracies++
+		case models.MoveMistake:
+			summary.Mistakes++
+		case models.MoveBlunder:
+			summary.Blunders++
+		}
+	}
+
+	analysis.TurningPoint = turningPoint(game, analysis.Moves)
+	analysis.AnalyzedAt = time.Now()
+	return analysis, nil
+}
+
+// gradeMove compares the outcome of the move played with that of the best
+// move. Estimated positions that can't see the end of the game fall back to
+// the size of the score drop.
+func gradeMove(ma models.MoveAnalysis) models.MoveQuality {
+	if ma.Score >= ma.BestScore {
+		return models.MoveBest
+	}
+
+	switch {
+	case ma.Outcome == OutcomeLoss && ma.BestOutcome != OutcomeLoss:
+		return models.MoveBlunder
+	case ma.BestOutcome == OutcomeWin && ma.Outcome != OutcomeWin:
+		return models.MoveMistake
+	case ma.Outcome != OutcomeUnclear && ma.Outcome == ma.BestOutcome:
+		return models.MoveInaccuracy
+	}
+
+	switch drop := ma.BestScore - ma.Score; {
+	case drop >= mistakeMargin:
+		return models.MoveMistake
+	case drop >= inaccuracyMargin:
+		return models.MoveInaccuracy
+	}
+	return models.MoveBest
+}
+
+// turningPoint finds the move after which the final result was certain and
+// stayed that way. Where early positions couldn't be worked out exactly, it
+// settles for the last mistake or blunder that let the result happen.
+func turningPoint(game *models.Game, moves []models.MoveAnalysis) int {
+	result := 0 // player number of the winner, 0 for a draw
+	if game.Winner != nil {
+		result = 2
+		if game.Winner.ID == game.Player1.ID {
+			result = 1
+		}
+	}
+
+	// Walk back while the position before each move was already decided
+	k := len(moves)
+	for k > 0 {
+		decided, known := decidedResult(moves[k-1])
+		if !known || decided != result {
+			break
+		}
+		k--
+	}
+
+	if k == 0 {
+		// Decided from the first move, as perfect play would have it
+		return 0
+	}
+	if _, known := decidedResult(moves[k-1]); known {
+		return moves[k-1].Number
+	}
+
+	for i := k - 1; i >= 0; i-- {
+		ma := moves[i]
+		if ma.Quality != models.MoveMistake && ma.Quality != models.MoveBlunder {
+			continue
+		}
+		if result == 0 || ma.PlayerNum != result {
+			return ma.Number
+		}
+	}
+	return 0
+}
+
+// decidedResult converts the value of the best move in a position into the
+// player number who wins with best play, or 0 for a draw.
+func decidedResult(ma models.MoveAnalysis) (int, bool) {
+	switch ma.BestOutcome {
+	case OutcomeWin:
+		return ma.PlayerNum, true
+	case OutcomeLoss:
+		return 3 - ma.PlayerNum, true
+	case OutcomeDraw:
+		return 0, true
+	}
+	return 0, false
+}
@@ -1,124 +1,280 @@
 package services
 
 import (
+	"connect-four-backend/engine"
 	"connect-four-backend/models"
+	"connect-four-backend/solver"
+	"context"
+	"errors"
+	"log"
 	"math/rand"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
-type Bot struct {
+// botSettings controls how strongly a bot level plays.
+type botSettings struct {
+	errorRate float64 // chance of playing a random column instead
+	depth     int     // lookahead in moves; 0 uses the rule-based heuristic
+	perfect   bool    // ask the solver first on standard boards
+}
+
+var botLevels = map[models.BotLevel]botSettings{
+	models.BotLevelEasy:    {errorRate: 0.35},
+	models.BotLevelMedium:  {},
+	models.BotLevelHard:    {depth: 6},
+	models.BotLevelPerfect: {depth: 6, perfect: true},
+}
+
+const (
+	// perfectThinkTime bounds a solver search. Without an opening book,
+	// positions in roughly the first ten moves take far longer to solve, in
+	// which case the perfect bot falls back to lookahead.
+	perfectThinkTime = 2 * time.Second
+
+	// solverPoolSize caps the solver searches for bots and hints running at
+	// once.
+	solverPoolSize = 4
+
+	// solverTableSize is the transposition table size of pooled solvers,
+	// about 9 MB each.
+	solverTableSize = 1 << 20
+)
+
+// perfectSolvers are the solvers perfect bots and hints search with.
+var perfectSolvers = newSolverPool(solverPoolSize)
+
+// OpeningBookFromEnv loads the solver opening book from the file named by
+// SOLVER_BOOK, in the text form solver.LoadBook reads. It returns nil if
+// none is set or the file can't be read, leaving early positions to
+// lookahead.
+func OpeningBookFromEnv() *solver.Book {
+	path := os.Getenv("SOLVER_BOOK")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Failed to open opening book: %v", err)
+		return nil
+	}
+	defer f.Close()
+
+	book, err := solver.LoadBook(f)
+	if err != nil {
+		log.Printf("Failed to load opening book %s: %v", path, err)
+		return nil
+	}
+	log.Printf("Loaded opening book %s with %d positions", path, book.Len())
+	return book
+}
+
+// solverPool hands out solvers, one caller at a time each, so searches in
+// different games don't queue behind one another unless all the solvers
+// are busy. Solvers are created on first use and keep their transposition
+// tables between searches.
+type solverPool struct {
+	free chan *solver.Solver // nil until first used
+	book atomic.Pointer[solver.Book]
+}
+
+// setBook gives every search from now on the opening book.
+func (p *solverPool) setBook(book *solver.Book) {
+	p.book.Store(book)
+}
+
+func newSolverPool(size int) *solverPool {
+	p := &solverPool{free: make(chan *solver.Solver, size)}
+	for i := 0; i < size; i++ {
+		p.free <- nil
+	}
+	return p
+}
+
+// acquire waits for a free solver, giving up with ctx.Err() once ctx is
+// done. The solver must be handed back with release.
+func (p *solverPool) acquire(ctx context.Context) (*solver.Solver, error) {
+	select {
+	case s := <-p.free:
+		if s == nil {
+			s = solver.New(solverTableSize)
+		}
+		s.SetBook(p.book.Load())
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *solverPool) release(s *solver.Solver) {
+	p.free <- s
+}
+
+// BuiltinBot is the in-process bot behind the difficulty levels: rule-based
+// heuristics for easy and medium, lookahead search for hard, and the solver
+// for perfect.
+type BuiltinBot struct {
 	PlayerNum int
+	Level     models.BotLevel
+	rng       *rand.Rand
 }
 
-func NewBot(playerNum int) *Bot {
-	return &Bot{PlayerNum: playerNum}
+// NewBuiltinBot creates a bot for the given player number. An empty level
+// plays at medium strength.
+func NewBuiltinBot(playerNum int, level models.BotLevel) *BuiltinBot {
+	if _, ok := botLevels[level]; !ok {
+		level = models.BotLevelMedium
+	}
+	return &BuiltinBot{
+		PlayerNum: playerNum,
+		Level:     level,
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// ChooseMove implements Bot. Only the perfect level searches for long; if
+// ctx's deadline cuts the solver short it plays by lookahead instead.
+func (b *BuiltinBot) ChooseMove(ctx context.Context, game *models.Game) (int, error) {
+	col := b.chooseMove(ctx, game)
+	if err := ctx.Err(); errors.Is(err, context.Canceled) {
+		return -1, err
+	}
+	if col == -1 {
+		return -1, ErrNoValidMove
+	}
+	return col, nil
 }
 
-// GetMove returns the bot's next move using strategic AI
-func (b *Bot) GetMove(game *models.Game) int {
-	opponentNum := 1
-	if b.PlayerNum == 1 {
-		opponentNum = 2
+func (b *BuiltinBot) chooseMove(ctx context.Context, game *models.Game) int {
+	settings := botLevels[b.Level]
+
+	if settings.errorRate > 0 && b.rng.Float64() < settings.errorRate {
+		if col := b.randomMove(game); col != -1 {
+			return col
+		}
+	}
+
+	if settings.perfect {
+		if col, ok := b.solverMove(ctx, game); ok {
+			return col
+		}
 	}
 
+	pos, err := positionOf(game)
+	if err != nil {
+		return b.getMoveOnBoard(game, settings.depth)
+	}
+
+	if settings.depth > 0 {
+		return searchMove(pos, b.PlayerNum, settings.depth)
+	}
+
+	return b.heuristicMove(&pos)
+}
+
+// solverMove asks the solver for the best move, reporting false if the
+// board isn't standard or the search runs out of time. Waiting for a solver
+// and the search together stop at ctx's deadline or after
+// perfectThinkTime, whichever comes first.
+func (b *BuiltinBot) solverMove(ctx context.Context, game *models.Game) (int, bool) {
+	pos, err := solver.FromGame(game)
+	if err != nil {
+		return -1, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, perfectThinkTime)
+	defer cancel()
+
+	s, err := perfectSolvers.acquire(ctx)
+	if err != nil {
+		return -1, false
+	}
+	defer perfectSolvers.release(s)
+
+	col, _, err := s.BestMove(ctx, pos)
+	if err != nil {
+		return -1, false
+	}
+	return col, true
+}
+
+// randomMove picks any playable column
+func (b *BuiltinBot) randomMove(game *models.Game) int {
+	validCols := []int{}
+	for c := 0; c < game.Rules.Columns; c++ {
+		if IsValidMove(game, c) {
+			validCols = append(validCols, c)
+		}
+	}
+
+	if len(validCols) == 0 {
+		return -1
+	}
+	return validCols[b.rng.Intn(len(validCols))]
+}
+
+// heuristicMove applies the fixed priorities of the rule-based bot
+func (b *BuiltinBot) heuristicMove(pos *engine.Position) int {
+	opponentNum := 3 - b.PlayerNum
+
 	// Priority 1: Win if possible
-	if col := b.findWinningMove(game, b.PlayerNum); col != -1 {
+	if col := b.findWinningMove(pos, b.PlayerNum); col != -1 {
 		return col
 	}
 
 	// Priority 2: Block opponent's winning move
-	if col := b.findWinningMove(game, opponentNum); col != -1 {
+	if col := b.findWinningMove(pos, opponentNum); col != -1 {
 		return col
 	}
 
 	// Priority 3: Create a threat (setup for next turn win)
-	if col := b.findThreatMove(game, b.PlayerNum); col != -1 {
+	if col := b.findThreatMove(pos, b.PlayerNum); col != -1 {
 		return col
 	}
 
 	// Priority 4: Block opponent's threat
-	if col := b.findThreatMove(game, opponentNum); col != -1 {
+	if col := b.findThreatMove(pos, opponentNum); col != -1 {
 		return col
 	}
 
 	// Priority 5: Take center columns (strategic advantage)
-	centerCols := []int{3, 2, 4, 1, 5, 0, 6}
-	for _, col := range centerCols {
-		if IsValidMove(game, col) {
+	for _, col := range centerOrder(pos.Columns()) {
+		if pos.CanPlay(col) {
 			return col
 		}
 	}
 
-	// Fallback: random valid move
-	validCols := []int{}
-	for c := 0; c < models.Columns; c++ {
-		if IsValidMove(game, c) {
-			validCols = append(validCols, c)
-		}
-	}
-
-	if len(validCols) > 0 {
-		rand.Seed(time.Now().UnixNano())
-		return validCols[rand.Intn(len(validCols))]
-	}
-
 	return -1
 }
 
 // findWinningMove finds a column that would result in a win for the player
-func (b *Bot) findWinningMove(game *models.Game, playerNum int) int {
-	for col := 0; col < models.Columns; col++ {
-		if !IsValidMove(game, col) {
-			continue
-		}
-
-		// Simulate the move
-		tempGame := b.copyGame(game)
-		row, err := MakeMove(tempGame, col, playerNum)
-		if err != nil {
-			continue
-		}
-
-		// Check if this move wins
-		if hasWon, _, _ := CheckWinner(tempGame); hasWon {
+func (b *BuiltinBot) findWinningMove(pos *engine.Position, playerNum int) int {
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.IsWinningMove(col, playerNum) {
 			return col
 		}
-
-		// Undo the move
-		tempGame.Board[row][col] = 0
 	}
 
 	return -1
 }
 
 // findThreatMove finds a move that creates multiple winning opportunities
-func (b *Bot) findThreatMove(game *models.Game, playerNum int) int {
-	for col := 0; col < models.Columns; col++ {
-		if !IsValidMove(game, col) {
+func (b *BuiltinBot) findThreatMove(pos *engine.Position, playerNum int) int {
+	for col := 0; col < pos.Columns(); col++ {
+		if !pos.CanPlay(col) {
 			continue
 		}
 
-		// Simulate the move
-		tempGame := b.copyGame(game)
-		row, err := MakeMove(tempGame, col, playerNum)
-		if err != nil {
-			continue
-		}
+		// Simulate the move on a copy
+		next := *pos
+		next.Play(col, playerNum)
 
 		// Count potential wins after this move
 		winCount := 0
-		for nextCol := 0; nextCol < models.Columns; nextCol++ {
-			if !IsValidMove(tempGame, nextCol) {
-				continue
-			}
-
-			tempGame2 := b.copyGame(tempGame)
-			_, err := MakeMove(tempGame2, nextCol, playerNum)
-			if err != nil {
-				continue
-			}
-
-			if hasWon, _, _ := CheckWinner(tempGame2); hasWon {
+		for nextCol := 0; nextCol < next.Columns(); nextCol++ {
+			if next.IsWinningMove(nextCol, playerNum) {
 				winCount++
 			}
 		}
@@ -127,38 +283,58 @@ func (b *Bot) findThreatMove(game *models.Game, playerNum int) int {
 		if winCount >= 2 {
 			return col
 		}
-
-		// Undo the move
-		tempGame.Board[row][col] = 0
 	}
 
 	return -1
 }
 
-// copyGame creates a deep copy of the game for simulation
-func (b *Bot) copyGame(game *models.Game) *models.Game {
-	newGame := &models.Game{
-		ID:          game.ID,
-		Player1:     game.Player1,
-		Player2:     game.Player2,
-		CurrentTurn: game.CurrentTurn,
-		State:       game.State,
-		Board:       make([][]int, models.Rows),
+// getMoveOnBoard picks a move for boards too large for a bitboard. Levels
+// with a lookahead depth search the board to that depth; the others only
+// look one move ahead: win, block, then prefer the center.
+func (b *BuiltinBot) getMoveOnBoard(game *models.Game, depth int) int {
+	if depth > 0 {
+		return searchBoardMove(game, b.PlayerNum, depth)
 	}
 
-	for i := range game.Board {
-		newGame.Board[i] = make([]int, models.Columns)
-		copy(newGame.Board[i], game.Board[i])
-	}
+	for _, playerNum := range []int{b.PlayerNum, 3 - b.PlayerNum} {
+		for col := 0; col < game.Rules.Columns; col++ {
+			if !IsValidMove(game, col) {
+				continue
+			}
 
-	if game.LastMoveCol != nil {
-		col := *game.LastMoveCol
-		newGame.LastMoveCol = &col
+			tempGame := CloneGame(game)
+			if _, err := MakeMove(tempGame, col, playerNum); err != nil {
+				continue
+			}
+
+			if hasWon, _, _ := CheckWinner(tempGame); hasWon {
+				return col
+			}
+		}
 	}
-	if game.LastMoveRow != nil {
-		row := *game.LastMoveRow
-		newGame.LastMoveRow = &row
+
+	for _, col := range centerOrder(game.Rules.Columns) {
+		if IsValidMove(game, col) {
+			return col
+		}
 	}
 
-	return newGame
+	return -1
+}
+
+// centerOrder returns the columns of a board ordered from the center outwards,
+// preferring the left of two equally central columns.
+func centerOrder(columns int) []int {
+	order := make([]int, 0, columns)
+	center := (columns - 1) / 2
+	order = append(order, center)
+	for d := 1; len(order) < columns; d++ {
+		if center-d >= 0 {
+			order = append(order, center-d)
+		}
+		if center+d < columns {
+			order = append(order, center+d)
+		}
+	}
+	return order
 }
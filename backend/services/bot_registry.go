@@ -0,0 +1,116 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoValidMove = errors.New("no valid move")
+	ErrUnknownBot  = errors.New("unknown bot implementation")
+)
+
+// Bot is a strategy that picks moves for a bot player. ChooseMove is given a
+// private copy of the game and returns the column to play. ctx's deadline is
+// the bot's time budget: once it passes, a bot should play the best move it
+// has found so far rather than fail. If ctx is cancelled instead, the move
+// is no longer wanted and the bot should return promptly with ctx.Err().
+type Bot interface {
+	ChooseMove(ctx context.Context, game *models.Game) (int, error)
+}
+
+// BotFactory builds a bot playing as playerNum from its spec.
+type BotFactory func(playerNum int, spec models.BotSpec) (Bot, error)
+
+// Names of the implementations every GameService registers.
+const (
+	BotBuiltin = "builtin"
+	BotMCTS    = "mcts"
+	BotEngine  = "engine"
+)
+
+// BotRegistry maps implementation names to factories.
+type BotRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]BotFactory
+}
+
+func NewBotRegistry() *BotRegistry {
+	return &BotRegistry{factories: make(map[string]BotFactory)}
+}
+
+// Register adds or replaces an implementation.
+func (r *BotRegistry) Register(name string, factory BotFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// New builds the bot described by spec.
+func (r *BotRegistry) New(playerNum int, spec models.BotSpec) (Bot, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[spec.Name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBot, spec.Name)
+	}
+	return factory(playerNum, spec)
+}
+
+// Names lists the registered implementations in alphabetical order.
+func (r *BotRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterDefaultBots installs the built-in, MCTS and external engine
+// implementations. engines maps bot levels to the external engine used for
+// them, and moveTime is the default engine think time.
+func RegisterDefaultBots(r *BotRegistry, engines map[models.BotLevel]*Engine, moveTime time.Duration) {
+	r.Register(BotBuiltin, func(playerNum int, spec models.BotSpec) (Bot, error) {
+		return NewBuiltinBot(playerNum, spec.Level), nil
+	})
+
+	// Settings: "thinkTimeMs" (default 1000), "seed" (default: clock)
+	r.Register(BotMCTS, func(playerNum int, spec models.BotSpec) (Bot, error) {
+		thinkTime := time.Duration(settingInt(spec, "thinkTimeMs", 1000)) * time.Millisecond
+		seed := int64(settingInt(spec, "seed", int(time.Now().UnixNano())))
+		bot := NewMCTSBot(playerNum, thinkTime, seed)
+		bot.Level = spec.Level
+		return bot, nil
+	})
+
+	// Settings: "moveTimeMs" (default BOT_ENGINE_MOVETIME_MS)
+	r.Register(BotEngine, func(playerNum int, spec models.BotSpec) (Bot, error) {
+		engine := engines[spec.Level]
+		if engine == nil {
+			return nil, fmt.Errorf("no engine configured for %s bots", spec.Level)
+		}
+		engineMoveTime := time.Duration(settingInt(spec, "moveTimeMs", int(moveTime.Milliseconds()))) * time.Millisecond
+		return NewExternalBot(playerNum, engine, engineMoveTime, spec.Level), nil
+	})
+}
+
+// settingInt reads an integer setting, falling back to def if it is missing
+// or malformed.
+func settingInt(spec models.BotSpec, key string, def int) int {
+	value, err := strconv.Atoi(spec.Settings[key])
+	if err != nil {
+		return def
+	}
+	return value
+}
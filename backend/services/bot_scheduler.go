@@ -0,0 +1,230 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBotThinkTime = 5 * time.Second
+	defaultBotMinDelay  = 500 * time.Millisecond
+	defaultBotMaxDelay  = 1500 * time.Millisecond
+
+	// botClockShare is the most of its remaining time a bot in a timed game
+	// spends on one move, counting both thinking and delay.
+	botClockShare = 10
+
+	// maxBotGames caps the bot-vs-bot games running at once.
+	maxBotGames = 4
+)
+
+var ErrTooManyBotGames = errors.New("too many bot games in progress")
+
+// BotTiming controls how long bots take over a move. A bot searches for at
+// most ThinkTime, and the move as a whole takes a random time between
+// MinDelay and MaxDelay, so bots don't answer instantly.
+type BotTiming struct {
+	ThinkTime time.Duration
+	MinDelay  time.Duration
+	MaxDelay  time.Duration
+}
+
+// BotTimingFromEnv reads BOT_THINK_TIME_MS, BOT_MIN_DELAY_MS and
+// BOT_MAX_DELAY_MS.
+func BotTimingFromEnv() BotTiming {
+	timing := BotTiming{
+		ThinkTime: envMillis("BOT_THINK_TIME_MS", defaultBotThinkTime),
+		MinDelay:  envMillis("BOT_MIN_DELAY_MS", defaultBotMinDelay),
+		MaxDelay:  envMillis("BOT_MAX_DELAY_MS", defaultBotMaxDelay),
+	}
+	if timing.MaxDelay < timing.MinDelay {
+		timing.MaxDelay = timing.MinDelay
+	}
+	return timing
+}
+
+// envMillis reads a duration in milliseconds, falling back to def if the
+// variable is missing or malformed. Zero is allowed.
+func envMillis(key string, def time.Duration) time.Duration {
+	ms, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || ms < 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// budget returns how long a bot may think and how long its move should
+// take in all. Timed games cap both at a share of the bot's clock.
+func (t BotTiming) budget(game *models.Game, rng *rand.Rand, now time.Time) (think, delay time.Duration) {
+	think, delay = t.ThinkTime, t.MinDelay
+	if spread := t.MaxDelay - t.MinDelay; spread > 0 {
+		delay += time.Duration(rng.Int63n(int64(spread)))
+	}
+
+	if game.Clock != nil {
+		limit := TimeLeft(game, now)[game.CurrentTurn-1] / botClockShare
+		if think > limit {
+			think = limit
+		}
+		if delay > limit {
+			delay = limit
+		}
+	}
+	return think, delay
+}
+
+// botScheduler plays the moves of bot players. GameService tells it about
+// every change to a game; whenever a bot is left to move it plays the move
+// in the background, and it calls off the move if the game ends first.
+type botScheduler struct {
+	gs     *GameService
+	timing BotTiming
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	turns map[string]context.CancelFunc // gameID -> bot turn in progress
+}
+
+func newBotScheduler(gs *GameService, timing BotTiming) *botScheduler {
+	return &botScheduler{
+		gs:     gs,
+		timing: timing,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		turns:  make(map[string]context.CancelFunc),
+	}
+}
+
+// notify reacts to a game event. Must be called with gamesMutex held, and
+// never blocks.
+func (s *botScheduler) notify(eventType GameEventType, game *models.Game) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.turns[game.ID]; ok {
+		cancel()
+		delete(s.turns, game.ID)
+	}
+	if eventType == EventGameOver || game.State != models.GameStatePlaying {
+		return
+	}
+
+	bot := game.Player1
+	if game.CurrentTurn == 2 {
+		bot = game.Player2
+	}
+	if bot == nil || !bot.IsBot {
+		return
+	}
+
+	think, delay := s.timing.budget(game, s.rng, time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	s.turns[game.ID] = cancel
+	go s.play(ctx, game.ID, bot.ID, len(game.Moves), think, delay)
+}
+
+// play works out and makes one bot move, unless ctx is cancelled first.
+func (s *botScheduler) play(ctx context.Context, gameID, botID string, moveNum int, think, delay time.Duration) {
+	started := time.Now()
+
+	thinkCtx, cancel := context.WithTimeout(ctx, think)
+	column, err := s.gs.ChooseBotMove(thinkCtx, gameID)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Printf("Bot in game %s failed to choose a move, falling back: %v", gameID, err)
+		if column, err = s.gs.fallbackBotMove(gameID); err != nil {
+			log.Printf("Bot in game %s has no move: %v", gameID, err)
+			return
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay - time.Since(started)):
+	}
+
+	if err := s.gs.makeBotMove(gameID, botID, moveNum, column); err != nil {
+		log.Printf("Bot move in game %s failed: %v", gameID, err)
+	}
+}
+
+// fallbackBotMove picks a move with the medium built-in bot, for when the
+// bot's own implementation fails or runs out of time.
+func (gs *GameService) fallbackBotMove(gameID string) (int, error) {
+	gs.gamesMutex.RLock()
+	game, exists := gs.games[gameID]
+	if !exists {
+		gs.gamesMutex.RUnlock()
+		return -1, ErrGameNotFound
+	}
+	playerNum := game.CurrentTurn
+	snapshot := CloneGame(game)
+	gs.gamesMutex.RUnlock()
+
+	return NewBuiltinBot(playerNum, models.BotLevelMedium).ChooseMove(context.Background(), snapshot)
+}
+
+// makeBotMove plays a bot's move, provided the game is still at the move
+// the bot was thinking about.
+func (gs *GameService) makeBotMove(gameID, botID string, moveNum int, column int) error {
+	_, _, err := gs.SubmitMove(gameID, botID, MoveRequest{Column: column, Number: moveNum + 1})
+	if err == ErrStaleMove || err == ErrGameOver {
+		return nil
+	}
+	return err
+}
+
+// StartBotGame starts a casual game between two bots, which the server
+// plays out on its own. It shows up among the live games for anyone to
+// watch. The game returned is a copy.
+func (gs *GameService) StartBotGame(bot1, bot2 models.BotSpec, rules models.Rules) (*models.Game, error) {
+	if _, err := gs.bots.New(1, bot1); err != nil {
+		return nil, err
+	}
+	if _, err := gs.bots.New(2, bot2); err != nil {
+		return nil, err
+	}
+
+	gs.gamesMutex.RLock()
+	running := 0
+	for _, game := range gs.games {
+		if game.State == models.GameStatePlaying && game.Player1.IsBot && game.Player2.IsBot {
+			running++
+		}
+	}
+	gs.gamesMutex.RUnlock()
+	if running >= maxBotGames {
+		return nil, ErrTooManyBotGames
+	}
+
+	game := gs.CreateGame(newBotPlayer(bot1), GameOptions{Rules: rules})
+	gs.JoinGame(game, newBotPlayer(bot2))
+
+	// The bots are already playing, so hand back a copy
+	gs.gamesMutex.RLock()
+	defer gs.gamesMutex.RUnlock()
+	return CloneGame(game), nil
+}
+
+func newBotPlayer(spec models.BotSpec) *models.Player {
+	username := "Bot"
+	if spec.Level != "" {
+		username += " (" + string(spec.Level) + ")"
+	}
+	return &models.Player{
+		ID:       GeneratePlayerID(),
+		Username: username,
+		IsBot:    true,
+		Bot:      &spec,
+	}
+}
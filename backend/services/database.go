@@ -18,6 +18,15 @@ func InitDB(db *sql.DB) error {
 		player2_is_bot BOOLEAN NOT NULL DEFAULT FALSE
 	);
 
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS variant VARCHAR(32) NOT NULL DEFAULT 'standard';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS moves JSONB NOT NULL DEFAULT '[]';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS bot_level VARCHAR(16) NOT NULL DEFAULT '';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS bot_name VARCHAR(32) NOT NULL DEFAULT '';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS rated BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS series_id VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS time_control VARCHAR(16) NOT NULL DEFAULT '';
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS end_reason VARCHAR(16) NOT NULL DEFAULT '';
+
 	CREATE TABLE IF NOT EXISTS leaderboard (
 		username VARCHAR(255) PRIMARY KEY,
 		wins INTEGER NOT NULL DEFAULT 0,
@@ -25,8 +34,48 @@ func InitDB(db *sql.DB) error {
 		draws INTEGER NOT NULL DEFAULT 0
 	);
 
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION NOT NULL DEFAULT 1500;
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION NOT NULL DEFAULT 350;
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating_volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06;
+
+	CREATE TABLE IF NOT EXISTS rating_history (
+		id SERIAL PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		game_id VARCHAR(255) NOT NULL,
+		rating DOUBLE PRECISION NOT NULL,
+		deviation DOUBLE PRECISION NOT NULL,
+		recorded_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS game_analysis (
+		game_id VARCHAR(255) PRIMARY KEY,
+		report JSONB NOT NULL,
+		analyzed_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS series (
+		id VARCHAR(255) PRIMARY KEY,
+		player1 VARCHAR(255) NOT NULL,
+		player2 VARCHAR(255) NOT NULL,
+		best_of INTEGER NOT NULL,
+		player1_wins INTEGER NOT NULL,
+		player2_wins INTEGER NOT NULL,
+		draws INTEGER NOT NULL,
+		winner VARCHAR(255),
+		game_ids JSONB NOT NULL DEFAULT '[]',
+		completed_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS active_games (
+		id VARCHAR(255) PRIMARY KEY,
+		state JSONB NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_games_completed_at ON games(completed_at);
 	CREATE INDEX IF NOT EXISTS idx_leaderboard_wins ON leaderboard(wins DESC);
+	CREATE INDEX IF NOT EXISTS idx_leaderboard_rating ON leaderboard(rating DESC);
+	CREATE INDEX IF NOT EXISTS idx_rating_history_username ON rating_history(username, id);
 	`
 
 	_, err := db.Exec(schema)
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bufio"
+	"connect-four-backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeouts for talking to an engine process. See ENGINE_PROTOCOL.md for the
+// protocol itself.
+const (
+	engineHandshakeTimeout = 5 * time.Second
+	engineGracePeriod      = 500 * time.Millisecond // allowed on top of movetime
+	engineRestartDelay     = 5 * time.Second        // minimum time between starts
+	defaultEngineMoveTime  = time.Second
+)
+
+var (
+	ErrEngineUnavailable = errors.New("engine unavailable")
+	ErrEngineCrashed     = errors.New("engine exited unexpectedly")
+	ErrEngineTimeout     = errors.New("engine did not answer in time")
+	ErrEngineProtocol    = errors.New("engine protocol error")
+)
+
+// Engine supervises an external engine process. The process is started on
+// first use and restarted after a crash or timeout, but never more than once
+// per engineRestartDelay so a broken engine can't spin. Requests are
+// serialised: an engine thinks about one position at a time, and a request
+// waiting its turn gives up when its context is done.
+type Engine struct {
+	command []string
+	name    string
+
+	turn      chan struct{} // holds a token while a request has the engine
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	lines     chan string   // closed when the process exits
+	done      chan struct{} // closed when we stop listening
+	lastStart time.Time
+}
+
+func NewEngine(command []string) *Engine {
+	return &Engine{command: command, name: command[0], turn: make(chan struct{}, 1)}
+}
+
+// LoadEnginesFromEnv reads BOT_ENGINE_<LEVEL> variables, each holding the
+// command line of the engine to use for that bot level.
+func LoadEnginesFromEnv() map[models.BotLevel]*Engine {
+	engines := make(map[models.BotLevel]*Engine)
+	for level := range botLevels {
+		command := strings.Fields(os.Getenv("BOT_ENGINE_" + strings.ToUpper(string(level))))
+		if len(command) == 0 {
+			continue
+		}
+		engines[level] = NewEngine(command)
+		log.Printf("Using external engine %q for %s bots", command[0], level)
+	}
+	return engines
+}
+
+// EngineMoveTimeFromEnv reads BOT_ENGINE_MOVETIME_MS.
+func EngineMoveTimeFromEnv() time.Duration {
+	ms, err := strconv.Atoi(os.Getenv("BOT_ENGINE_MOVETIME_MS"))
+	if err != nil || ms <= 0 {
+		return defaultEngineMoveTime
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// BestMove asks the engine for a move in the game's current position.
+func (e *Engine) BestMove(ctx context.Context, game *models.Game, moveTime time.Duration) (int, error) {
+	select {
+	case e.turn <- struct{}{}:
+		defer func() { <-e.turn }()
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+
+	if err := e.ensureRunning(); err != nil {
+		return -1, err
+	}
+
+	// Make sure nothing from an earlier, abandoned search is still queued
+	if err := e.send("isready"); err != nil {
+		return -1, e.fail(err)
+	}
+	if _, err := e.await(ctx, "readyok", engineHandshakeTimeout); err != nil {
+		return -1, e.fail(err)
+	}
+
+	position, err := positionCommand(game)
+	if err != nil {
+		return -1, err
+	}
+	if err := e.send(position, fmt.Sprintf("go movetime %d", moveTime.Milliseconds())); err != nil {
+		return -1, e.fail(err)
+	}
+
+	line, err := e.await(ctx, "bestmove", moveTime+engineGracePeriod)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The game moved on; let the engine finish quietly
+		e.send("stop")
+		return -1, err
+	}
+	if err != nil {
+		return -1, e.fail(err)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return -1, e.fail(ErrEngineProtocol)
+	}
+	col, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return -1, e.fail(ErrEngineProtocol)
+	}
+	return col, nil
+}
+
+// Close stops the engine process if it is running.
+func (e *Engine) Close() {
+	e.turn <- struct{}{}
+	defer func() { <-e.turn }()
+
+	if e.cmd != nil {
+		e.send("quit")
+		e.stop()
+	}
+}
+
+// positionCommand describes a game as a position line.
+func positionCommand(game *models.Game) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "position %d %d %d", game.Rules.Columns, game.Rules.Rows, game.Rules.ConnectN)
+
+	if len(game.Moves) > 0 {
+		b.WriteString(" moves")
+		for _, move := range game.Moves {
+			fmt.Fprintf(&b, " %d", move.Column)
+		}
+	} else {
+		for _, row := range game.Board {
+			for _, cell := range row {
+				if cell != 0 {
+					// A board without history can't be described
+					return "", ErrEngineProtocol
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+func (e *Engine) ensureRunning() error {
+	if e.cmd != nil {
+		return nil
+	}
+	if time.Since(e.lastStart) < engineRestartDelay {
+		return ErrEngineUnavailable
+	}
+	e.lastStart = time.Now()
+
+	cmd := exec.Command(e.command[0], e.command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start engine %s: %v", e.name, err)
+		return ErrEngineUnavailable
+	}
+
+	lines := make(chan string, 64)
+	done := make(chan struct{})
+	go func() {
+		defer cmd.Wait()
+		defer close(lines)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSpace(scanner.Text()):
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	e.cmd, e.stdin, e.lines, e.done = cmd, stdin, lines, done
+
+	if err := e.send("c4i"); err != nil {
+		return e.fail(err)
+	}
+	if _, err := e.await(context.Background(), "c4iok", engineHandshakeTimeout); err != nil {
+		return e.fail(err)
+	}
+
+	log.Printf("Engine %s started", e.name)
+	return nil
+}
+
+func (e *Engine) send(lines ...string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(e.stdin, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// await reads lines until one starts with the given token. "id name" lines
+// are remembered and anything else, such as "info", is ignored.
+func (e *Engine) await(ctx context.Context, token string, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return "", ErrEngineCrashed
+			}
+			if strings.HasPrefix(line, "id name ") {
+				e.name = strings.TrimPrefix(line, "id name ")
+			}
+			if line == token || strings.HasPrefix(line, token+" ") {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", ErrEngineTimeout
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// fail logs an engine error and kills the process so the next request
+// starts a fresh one.
+func (e *Engine) fail(err error) error {
+	log.Printf("Engine %s failed: %v", e.name, err)
+	e.stop()
+	return err
+}
+
+func (e *Engine) stop() {
+	if e.cmd == nil {
+		return
+	}
+	close(e.done)
+	e.stdin.Close()
+	e.cmd.Process.Kill()
+	e.cmd, e.stdin, e.lines, e.done = nil, nil, nil, nil
+}
+
+// ExternalBot plays the moves chosen by an external engine, falling back to
+// the built-in bot whenever the engine can't answer or answers nonsense.
+type ExternalBot struct {
+	PlayerNum int
+	MoveTime  time.Duration
+	engine    *Engine
+	fallback  *BuiltinBot
+}
+
+func NewExternalBot(playerNum int, engine *Engine, moveTime time.Duration, fallbackLevel models.BotLevel) *ExternalBot {
+	return &ExternalBot{
+		PlayerNum: playerNum,
+		MoveTime:  moveTime,
+		engine:    engine,
+		fallback:  NewBuiltinBot(playerNum, fallbackLevel),
+	}
+}
+
+// ChooseMove implements Bot. The engine's movetime is cut short to fit
+// ctx's deadline. It only fails if ctx is cancelled first.
+func (b *ExternalBot) ChooseMove(ctx context.Context, game *models.Game) (int, error) {
+	moveTime := b.MoveTime
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) - engineGracePeriod; left < moveTime {
+			moveTime = left
+		}
+	}
+
+	col, err := -1, ErrEngineTimeout
+	if moveTime > 0 {
+		col, err = b.engine.BestMove(ctx, game, moveTime)
+	}
+	if ctxErr := ctx.Err(); errors.Is(ctxErr, context.Canceled) {
+		return -1, ctxErr
+	}
+	if err != nil {
+		return b.fallback.ChooseMove(ctx, game)
+	}
+	if !IsValidMove(game, col) {
+		log.Printf("Engine %s chose invalid column %d", b.engine.command[0], col)
+		return b.fallback.ChooseMove(ctx, game)
+	}
+	return col, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"sync"
+	"time"
+)
+
+// GameEventType says what happened to a game.
+type GameEventType string
+
+const (
+	EventGameStarted GameEventType = "game_started" // both players are in and play can begin
+	EventGameUpdated GameEventType = "game_updated" // a move was made
+	EventGameResumed GameEventType = "game_resumed" // a game reloaded after a restart carries on
+	EventGameOver    GameEventType = "game_over"    // the game ended, on the board or otherwise
+)
+
+// GameEvent is published whenever a game changes. Game is a copy taken at
+// the time, so it can be sent on without holding the game lock.
+type GameEvent struct {
+	Type GameEventType
+	Game *models.Game
+}
+
+// eventQueue hands game events on to a channel in order without making
+// whoever publishes them wait. Events queue up until the channel is read,
+// so games reloaded before the hub starts don't block startup.
+type eventQueue struct {
+	out chan GameEvent
+
+	mu      sync.Mutex
+	pending []GameEvent
+	ready   chan struct{} // signalled when pending gains an event
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{
+		out:   make(chan GameEvent),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+func (q *eventQueue) push(event GameEvent) {
+	q.mu.Lock()
+	q.pending = append(q.pending, event)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run forwards queued events to out, one at a time and in order.
+func (q *eventQueue) run() {
+	for range q.ready {
+		for {
+			q.mu.Lock()
+			if len(q.pending) == 0 {
+				q.pending = nil
+				q.mu.Unlock()
+				break
+			}
+			event := q.pending[0]
+			q.pending[0] = GameEvent{}
+			q.pending = q.pending[1:]
+			q.mu.Unlock()
+
+			q.out <- event
+		}
+	}
+}
+
+// Events delivers every game event in the order they happened. Events wait
+// in memory until they are read, so something should keep reading it.
+func (gs *GameService) Events() <-chan GameEvent {
+	return gs.events.out
+}
+
+// publish queues an event for a game, saves the game's new state, starts
+// the clock of the player to move and lets a bot that is left to move
+// start on its move. Must be called with gamesMutex held, which keeps
+// events in the order the changes were made. It never waits for the hub.
+func (gs *GameService) publish(eventType GameEventType, game *models.Game) {
+	snapshot := CloneGame(game)
+	gs.store.save(snapshot)
+	gs.scheduleFlag(game, time.Now())
+	if !gs.paused[game.ID] {
+		gs.botTurns.notify(eventType, game)
+	}
+	gs.events.push(GameEvent{Type: eventType, Game: snapshot})
+}
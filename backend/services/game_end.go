@@ -0,0 +1,152 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrNoDrawOffer    = errors.New("no draw has been offered")
+	ErrDrawDeclined   = errors.New("draw declined")
+	ErrTooLateToAbort = errors.New("game can only be aborted before both players have moved")
+)
+
+// Resign ends the game as a loss for the player resigning. Players can
+// resign on either player's turn.
+func (gs *GameService) Resign(gameID string, playerID string) (*models.Game, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, playerNum, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	winner := game.Player1
+	if playerNum == 1 {
+		winner = game.Player2
+	}
+	gs.finishGame(game, winner, models.ReasonResign)
+	return game, nil
+}
+
+// OfferDraw offers the opponent a draw, which stands until they accept,
+// decline or make a move. If the opponent had offered one first, the game
+// is drawn at once and true is returned. Bots decline every offer.
+func (gs *GameService) OfferDraw(gameID string, playerID string) (bool, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, playerNum, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return false, err
+	}
+
+	opponentNum := 3 - playerNum
+	if game.DrawOffer == opponentNum {
+		gs.finishGame(game, nil, models.ReasonDrawAgreed)
+		return true, nil
+	}
+
+	opponent := game.Player1
+	if opponentNum == 2 {
+		opponent = game.Player2
+	}
+	if opponent.IsBot {
+		return false, ErrDrawDeclined
+	}
+
+	game.DrawOffer = playerNum
+	return false, nil
+}
+
+// AcceptDraw accepts the opponent's draw offer, which ends the game.
+func (gs *GameService) AcceptDraw(gameID string, playerID string) (*models.Game, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, playerNum, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if game.DrawOffer != 3-playerNum {
+		return nil, ErrNoDrawOffer
+	}
+
+	gs.finishGame(game, nil, models.ReasonDrawAgreed)
+	return game, nil
+}
+
+// DeclineDraw turns down the opponent's draw offer.
+func (gs *GameService) DeclineDraw(gameID string, playerID string) (*models.Game, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, playerNum, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if game.DrawOffer != 3-playerNum {
+		return nil, ErrNoDrawOffer
+	}
+
+	game.DrawOffer = 0
+	return game, nil
+}
+
+// Abort calls off a game before both players have made a move. Aborted
+// games are kept but don't count for anyone.
+func (gs *GameService) Abort(gameID string, playerID string) (*models.Game, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, _, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(game.Moves) >= 2 {
+		return nil, ErrTooLateToAbort
+	}
+
+	gs.finishGame(game, nil, models.ReasonAborted)
+	return game, nil
+}
+
+// activeGame looks up a game in progress and the player number of one of
+// its players. Must be called with gamesMutex held.
+func (gs *GameService) activeGame(gameID string, playerID string) (*models.Game, int, error) {
+	game, exists := gs.games[gameID]
+	if !exists {
+		return nil, 0, ErrGameNotFound
+	}
+
+	playerNum := 0
+	if game.Player1.ID == playerID {
+		playerNum = 1
+	} else if game.Player2 != nil && game.Player2.ID == playerID {
+		playerNum = 2
+	}
+
+	switch {
+	case playerNum == 0:
+		return nil, 0, ErrNotInGame
+	case game.State != models.GameStatePlaying:
+		return nil, 0, ErrGameOver
+	}
+	return game, playerNum, nil
+}
+
+// finishGame ends a game that wasn't decided on the board. Must be called
+// with gamesMutex held.
+func (gs *GameService) finishGame(game *models.Game, winner *models.Player, reason string) {
+	now := time.Now()
+	game.State = models.GameStateFinished
+	game.Winner = winner
+	game.DrawOffer = 0
+	game.EndTime = &now
+
+	log.Printf("Game %s ended: %s", game.ID, reason)
+	gs.saveGameResult(game, reason)
+}
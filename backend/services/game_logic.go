@@ -1,27 +1,37 @@
 package services
 
 import (
+	"connect-four-backend/engine"
 	"connect-four-backend/models"
-	"errors"
+	"time"
 )
 
-// MakeMove attempts to make a move in the specified column
-func MakeMove(game *models.Game, column int, playerNum int) (int, error) {
-	if column < 0 || column >= models.Columns {
-		return -1, errors.New("invalid column")
+// positionOf returns the game's bitboard, building it from the board for
+// games that don't carry one, such as games reloaded after a restart.
+// Boards that are too large for a bitboard return an error and callers
+// fall back to scanning game.Board directly.
+func positionOf(game *models.Game) (engine.Position, error) {
+	if game.Position.Columns() > 0 {
+		return game.Position, nil
 	}
+	return engine.FromBoard(game.Board, game.Rules.ConnectN)
+}
 
-	// Find the lowest empty row in the column
-	row := -1
-	for r := models.Rows - 1; r >= 0; r-- {
-		if game.Board[r][column] == 0 {
-			row = r
-			break
+// MakeMove attempts to make a move in the specified column
+func MakeMove(game *models.Game, column int, playerNum int) (int, error) {
+	var row int
+	if pos, err := positionOf(game); err == nil {
+		height, err := pos.Play(column, playerNum)
+		if err != nil {
+			return -1, err
+		}
+		game.Position = pos
+		row = game.Rules.Rows - 1 - height
+	} else {
+		row, err = lowestEmptyRow(game, column)
+		if err != nil {
+			return -1, err
 		}
-	}
-
-	if row == -1 {
-		return -1, errors.New("column is full")
 	}
 
 	// Place the disc
@@ -32,6 +42,42 @@ func MakeMove(game *models.Game, column int, playerNum int) (int, error) {
 	return row, nil
 }
 
+// RecordMove makes a move and appends it to the game's move history
+func RecordMove(game *models.Game, column int, playerNum int, playerID string) (int, error) {
+	row, err := MakeMove(game, column, playerNum)
+	if err != nil {
+		return -1, err
+	}
+
+	game.Moves = append(game.Moves, models.Move{
+		Number:    len(game.Moves) + 1,
+		Column:    column,
+		Row:       row,
+		PlayerNum: playerNum,
+		PlayerID:  playerID,
+		Timestamp: time.Now(),
+		HintUsed:  game.Hints.Pending[playerNum-1],
+	})
+	game.Hints.Pending[playerNum-1] = false
+
+	return row, nil
+}
+
+// lowestEmptyRow finds where a disc dropped in the column would land
+func lowestEmptyRow(game *models.Game, column int) (int, error) {
+	if column < 0 || column >= game.Rules.Columns {
+		return -1, engine.ErrInvalidColumn
+	}
+
+	for r := game.Rules.Rows - 1; r >= 0; r-- {
+		if game.Board[r][column] == 0 {
+			return r, nil
+		}
+	}
+
+	return -1, engine.ErrColumnFull
+}
+
 // CheckWinner checks if there's a winner after the last move
 func CheckWinner(game *models.Game) (bool, *models.Player, [][]int) {
 	if game.LastMoveRow == nil || game.LastMoveCol == nil {
@@ -42,52 +88,47 @@ func CheckWinner(game *models.Game) (bool, *models.Player, [][]int) {
 	col := *game.LastMoveCol
 	playerNum := game.Board[row][col]
 
-	// Check horizontal
-	if line := checkDirection(game.Board, row, col, 0, 1, playerNum); line != nil {
-		winner := game.Player1
-		if playerNum == 2 {
-			winner = game.Player2
+	var line [][]int
+	if pos, err := positionOf(game); err == nil {
+		for _, cell := range pos.WinningLine(playerNum) {
+			line = append(line, []int{game.Rules.Rows - 1 - cell[1], cell[0]})
 		}
-		return true, winner, line
+	} else {
+		line = findLine(game, row, col, playerNum)
 	}
 
-	// Check vertical
-	if line := checkDirection(game.Board, row, col, 1, 0, playerNum); line != nil {
-		winner := game.Player1
-		if playerNum == 2 {
-			winner = game.Player2
-		}
-		return true, winner, line
+	if line == nil {
+		return false, nil, nil
 	}
 
-	// Check diagonal (down-right)
-	if line := checkDirection(game.Board, row, col, 1, 1, playerNum); line != nil {
-		winner := game.Player1
-		if playerNum == 2 {
-			winner = game.Player2
-		}
-		return true, winner, line
+	winner := game.Player1
+	if playerNum == 2 {
+		winner = game.Player2
 	}
+	return true, winner, line
+}
 
-	// Check diagonal (down-left)
-	if line := checkDirection(game.Board, row, col, 1, -1, playerNum); line != nil {
-		winner := game.Player1
-		if playerNum == 2 {
-			winner = game.Player2
+// findLine scans the board around (row, col) for a winning line, for boards
+// that don't fit in a bitboard
+func findLine(game *models.Game, row, col, playerNum int) [][]int {
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		if line := checkDirection(game, row, col, d[0], d[1], playerNum); line != nil {
+			return line
 		}
-		return true, winner, line
 	}
-
-	return false, nil, nil
+	return nil
 }
 
-// checkDirection checks for 4 in a row in a specific direction
-func checkDirection(board [][]int, row, col, dRow, dCol, playerNum int) [][]int {
+// checkDirection checks for ConnectN in a row in a specific direction
+func checkDirection(game *models.Game, row, col, dRow, dCol, playerNum int) [][]int {
+	board := game.Board
+	rows, cols, n := game.Rules.Rows, game.Rules.Columns, game.Rules.ConnectN
 	positions := [][]int{{row, col}}
 
 	// Check forward
 	r, c := row+dRow, col+dCol
-	for len(positions) < 4 && r >= 0 && r < models.Rows && c >= 0 && c < models.Columns {
+	for len(positions) < n && r >= 0 && r < rows && c >= 0 && c < cols {
 		if board[r][c] == playerNum {
 			positions = append(positions, []int{r, c})
 			r += dRow
@@ -99,7 +140,7 @@ func checkDirection(board [][]int, row, col, dRow, dCol, playerNum int) [][]int
 
 	// Check backward
 	r, c = row-dRow, col-dCol
-	for len(positions) < 4 && r >= 0 && r < models.Rows && c >= 0 && c < models.Columns {
+	for len(positions) < n && r >= 0 && r < rows && c >= 0 && c < cols {
 		if board[r][c] == playerNum {
 			positions = append([][]int{{r, c}}, positions...)
 			r -= dRow
@@ -109,8 +150,8 @@ func checkDirection(board [][]int, row, col, dRow, dCol, playerNum int) [][]int
 		}
 	}
 
-	if len(positions) >= 4 {
-		return positions[:4]
+	if len(positions) >= n {
+		return positions[:n]
 	}
 
 	return nil
@@ -118,7 +159,7 @@ func checkDirection(board [][]int, row, col, dRow, dCol, playerNum int) [][]int
 
 // IsBoardFull checks if the board is completely full
 func IsBoardFull(game *models.Game) bool {
-	for c := 0; c < models.Columns; c++ {
+	for c := 0; c < game.Rules.Columns; c++ {
 		if game.Board[0][c] == 0 {
 			return false
 		}
@@ -128,8 +169,59 @@ func IsBoardFull(game *models.Game) bool {
 
 // IsValidMove checks if a move is valid
 func IsValidMove(game *models.Game, column int) bool {
-	if column < 0 || column >= models.Columns {
+	if column < 0 || column >= game.Rules.Columns {
 		return false
 	}
 	return game.Board[0][column] == 0
 }
+
+// CloneGame creates a deep copy of the game's board and history, so it can
+// be read or simulated on without holding the game lock
+func CloneGame(game *models.Game) *models.Game {
+	newGame := &models.Game{
+		ID:          game.ID,
+		Player1:     game.Player1,
+		Player2:     game.Player2,
+		CurrentTurn: game.CurrentTurn,
+		State:       game.State,
+		Winner:      game.Winner,
+		Rules:       game.Rules,
+		Board:       make([][]int, game.Rules.Rows),
+		WinningLine: game.WinningLine,
+		Moves:       append([]models.Move{}, game.Moves...),
+		StartTime:   game.StartTime,
+		EndTime:     game.EndTime,
+		Rated:       game.Rated,
+		Hints:       game.Hints,
+		TimeControl: game.TimeControl,
+		EndReason:   game.EndReason,
+		DrawOffer:   game.DrawOffer,
+		Sessions:    game.Sessions,
+		Position:    game.Position,
+	}
+
+	for i := range game.Board {
+		newGame.Board[i] = make([]int, game.Rules.Columns)
+		copy(newGame.Board[i], game.Board[i])
+	}
+
+	if game.LastMoveCol != nil {
+		col := *game.LastMoveCol
+		newGame.LastMoveCol = &col
+	}
+	if game.LastMoveRow != nil {
+		row := *game.LastMoveRow
+		newGame.LastMoveRow = &row
+	}
+	if game.Clock != nil {
+		clock := *game.Clock
+		newGame.Clock = &clock
+	}
+	if game.Series != nil {
+		series := *game.Series
+		series.GameIDs = append([]string(nil), game.Series.GameIDs...)
+		newGame.Series = &series
+	}
+
+	return newGame
+}
@@ -2,9 +2,13 @@ package services
 
 import (
 	"connect-four-backend/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,9 +22,40 @@ type GameService struct {
 	gamesMutex   sync.RWMutex
 	kafka        *KafkaProducer
 	kafkaEnabled bool
-	disconnected map[string]time.Time // playerID -> disconnect time
+	disconnected map[string]time.Time   // playerID -> reconnect deadline
+	paused       map[string]bool        // IDs of reloaded games waiting for their players
+	flagTimers   map[string]*time.Timer // gameID -> timer for the player to move running out
+	store        *gameStore
+
+	sessionSecret []byte // key session tokens are signed with
+
+	bots           *BotRegistry
+	engines        map[models.BotLevel]*Engine // external engines by bot level
+	mctsLevels     map[models.BotLevel]bool    // levels played by the MCTS bot
+	engineMoveTime time.Duration
+	hintLimit      int // hints per player in casual games
+
+	rematchOffers map[string]rematchOffer   // finished game ID -> pending offer
+	moveResults   map[string]map[string]int // gameID -> "playerID:moveID" -> number of the played move
+	events        *eventQueue
+	botTurns      *botScheduler
+
+	analysis *AnalysisService
+	ratings  *RatingService
 }
 
+var (
+	ErrGameNotFound  = errors.New("game not found")
+	ErrNotBotTurn    = errors.New("it is not a bot's turn")
+	ErrNotInGame     = errors.New("not a player in this game")
+	ErrNotYourTurn   = errors.New("not your turn")
+	ErrGameOver      = errors.New("game is already over")
+	ErrHintsDisabled = errors.New("hints are not available in this game")
+	ErrNoHintsLeft   = errors.New("no hints left")
+	ErrHintPending   = errors.New("a hint is already being worked out")
+	ErrStaleHint     = errors.New("the position changed while the hint was worked out")
+)
+
 func NewGameService(db *sql.DB, kafkaBrokers string) *GameService {
 	var kafka *KafkaProducer
 	kafkaEnabled := os.Getenv("KAFKA_ENABLED") == "true"
@@ -32,6 +67,9 @@ func NewGameService(db *sql.DB, kafkaBrokers string) *GameService {
 		log.Println("Game service initialized with Kafka disabled")
 	}
 
+	book := OpeningBookFromEnv()
+	perfectSolvers.setBook(book)
+
 	gs := &GameService{
 		db:           db,
 		games:        make(map[string]*models.Game),
@@ -39,7 +77,29 @@ func NewGameService(db *sql.DB, kafkaBrokers string) *GameService {
 		kafka:        kafka,
 		kafkaEnabled: kafkaEnabled,
 		disconnected: make(map[string]time.Time),
+		paused:       make(map[string]bool),
+		flagTimers:   make(map[string]*time.Timer),
+		store:        newGameStore(db),
+
+		sessionSecret: SessionSecretFromEnv(),
+
+		bots:           NewBotRegistry(),
+		engines:        LoadEnginesFromEnv(),
+		mctsLevels:     MCTSLevelsFromEnv(),
+		engineMoveTime: EngineMoveTimeFromEnv(),
+		hintLimit:      HintLimitFromEnv(),
+
+		rematchOffers: make(map[string]rematchOffer),
+		moveResults:   make(map[string]map[string]int),
+		events:        newEventQueue(),
+
+		analysis: NewAnalysisService(db, book),
+		ratings:  NewRatingService(db),
 	}
+	RegisterDefaultBots(gs.bots, gs.engines, gs.engineMoveTime)
+	gs.botTurns = newBotScheduler(gs, BotTimingFromEnv())
+	go gs.events.run()
+	gs.recoverGames()
 
 	// Start cleanup goroutine for disconnected players
 	go gs.cleanupDisconnectedPlayers()
@@ -47,11 +107,30 @@ func NewGameService(db *sql.DB, kafkaBrokers string) *GameService {
 	return gs
 }
 
-func (gs *GameService) CreateGame(player *models.Player) *models.Game {
+// GameOptions describes the game to create.
+type GameOptions struct {
+	Rules       models.Rules
+	Rated       bool
+	BestOf      int // series length, or 0 for a single game
+	TimeControl models.TimeControl
+}
+
+// CreateGame starts a game waiting for a second player. Casual games allow
+// a limited number of hints; rated games allow none. The clock of a timed
+// game starts once the second player joins.
+func (gs *GameService) CreateGame(player *models.Player, opts GameOptions) *models.Game {
 	gs.gamesMutex.Lock()
 	defer gs.gamesMutex.Unlock()
 
-	game := models.NewGame(player)
+	game := models.NewGame(player, opts.Rules)
+	game.Rated = opts.Rated
+	game.TimeControl = opts.TimeControl
+	if !opts.Rated {
+		game.Hints.Limit = gs.hintLimit
+	}
+	if opts.BestOf > 1 {
+		game.Series = newSeries(game, opts.BestOf)
+	}
 	gs.games[game.ID] = game
 	gs.playerGames[player.ID] = game.ID
 
@@ -65,57 +144,66 @@ func (gs *GameService) JoinGame(game *models.Game, player *models.Player) {
 	game.Player2 = player
 	game.State = models.GameStatePlaying
 	gs.playerGames[player.ID] = game.ID
+	if game.Series != nil {
+		game.Series.Players[1] = player
+	}
+	startClock(game, time.Now())
+	startSessions(game)
 
 	// Send Kafka event
 	if gs.kafkaEnabled && gs.kafka != nil {
 		gs.kafka.SendEvent(GameStartEvent{
-			Type:       "game_start",
-			GameID:     game.ID,
-			Player1:    game.Player1.Username,
-			Player2:    game.Player2.Username,
-			Player1Bot: game.Player1.IsBot,
-			Player2Bot: game.Player2.IsBot,
-			Timestamp:  time.Now(),
+			Type:        "game_start",
+			GameID:      game.ID,
+			Player1:     game.Player1.Username,
+			Player2:     game.Player2.Username,
+			Player1Bot:  game.Player1.IsBot,
+			Player2Bot:  game.Player2.IsBot,
+			TimeControl: game.TimeControl.String(),
+			Timestamp:   time.Now(),
 		})
 	}
-}
 
-func (gs *GameService) MakeMove(gameID string, playerID string, column int) error {
-	gs.gamesMutex.Lock()
-	defer gs.gamesMutex.Unlock()
-
-	game, exists := gs.games[gameID]
-	if !exists {
-		return nil
-	}
+	gs.publish(EventGameStarted, game)
+}
 
-	// Determine player number
-	playerNum := 1
-	playerName := game.Player1.Username
-	if playerID == game.Player2.ID {
-		playerNum = 2
-		playerName = game.Player2.Username
+// playMove makes a move for the player to move, then ends the game or
+// passes the turn. Must be called with gamesMutex held.
+func (gs *GameService) playMove(game *models.Game, playerNum int, column int) error {
+	player := game.Player1
+	if playerNum == 2 {
+		player = game.Player2
 	}
 
-	// Check if it's the player's turn
-	if game.CurrentTurn != playerNum {
-		return nil
+	// A move that arrives after the player's time ran out loses on time,
+	// even if the clock watcher hasn't noticed yet
+	now := time.Now()
+	if outOfTime(game, now) {
+		gs.endOnTime(game, now)
+		return ErrOutOfTime
 	}
 
 	// Make the move
-	row, err := MakeMove(game, column, playerNum)
+	row, err := RecordMove(game, column, playerNum, player.ID)
 	if err != nil {
 		return err
 	}
+	chargeClock(game, playerNum, now)
+
+	// Moving instead of answering a draw offer declines it
+	if game.DrawOffer != 0 && game.DrawOffer != playerNum {
+		game.DrawOffer = 0
+	}
 
 	// Send move event to Kafka
 	if gs.kafkaEnabled && gs.kafka != nil {
 		gs.kafka.SendEvent(GameMoveEvent{
 			Type:      "game_move",
-			GameID:    gameID,
-			Player:    playerName,
+			GameID:    game.ID,
+			Player:    player.Username,
 			Column:    column,
 			Row:       row,
+			HintUsed:  game.Moves[len(game.Moves)-1].HintUsed,
 			Timestamp: time.Now(),
 		})
 	}
@@ -128,7 +216,8 @@ func (gs *GameService) MakeMove(gameID string, playerID string, column int) erro
 		game.WinningLine = winningLine
 		endTime := time.Now()
 		game.EndTime = &endTime
-		gs.saveGameResult(game, "win")
+		gs.publish(EventGameUpdated, game)
+		gs.saveGameResult(game, models.ReasonWin)
 		return nil
 	}
 
@@ -137,12 +226,14 @@ func (gs *GameService) MakeMove(gameID string, playerID string, column int) erro
 		game.State = models.GameStateFinished
 		endTime := time.Now()
 		game.EndTime = &endTime
-		gs.saveGameResult(game, "draw")
+		gs.publish(EventGameUpdated, game)
+		gs.saveGameResult(game, models.ReasonDraw)
 		return nil
 	}
 
 	// Switch turn
 	game.CurrentTurn = 3 - game.CurrentTurn
+	gs.publish(EventGameUpdated, game)
 
 	return nil
 }
@@ -153,16 +244,59 @@ func (gs *GameService) GetGame(gameID string) *models.Game {
 	return gs.games[gameID]
 }
 
+// GetGameSnapshot returns a copy of a game, which can be read without the
+// game lock, or nil if there is no such game.
+func (gs *GameService) GetGameSnapshot(gameID string) *models.Game {
+	gs.gamesMutex.RLock()
+	defer gs.gamesMutex.RUnlock()
+
+	game, exists := gs.games[gameID]
+	if !exists {
+		return nil
+	}
+	return CloneGame(game)
+}
+
+// GetPlayerGame returns a copy of the game a player is in, which may have
+// finished, or nil.
 func (gs *GameService) GetPlayerGame(playerID string) *models.Game {
 	gs.gamesMutex.RLock()
 	defer gs.gamesMutex.RUnlock()
 
-	gameID, exists := gs.playerGames[playerID]
+	game, exists := gs.games[gs.playerGames[playerID]]
 	if !exists {
 		return nil
 	}
+	return CloneGame(game)
+}
 
-	return gs.games[gameID]
+// LiveGames lists the games in progress between two players, newest first.
+// Spectator counts are left for the caller to fill in.
+func (gs *GameService) LiveGames() []models.LiveGame {
+	gs.gamesMutex.RLock()
+	defer gs.gamesMutex.RUnlock()
+
+	live := []models.LiveGame{}
+	for _, game := range gs.games {
+		if game.State != models.GameStatePlaying {
+			continue
+		}
+		live = append(live, models.LiveGame{
+			ID:          game.ID,
+			Rules:       game.Rules,
+			Player1:     game.Player1,
+			Player2:     game.Player2,
+			Rated:       game.Rated,
+			TimeControl: game.TimeControl,
+			MoveCount:   len(game.Moves),
+			StartTime:   game.StartTime,
+		})
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].StartTime.After(live[j].StartTime)
+	})
+	return live
 }
 
 func (gs *GameService) RemoveGame(gameID string) {
@@ -177,18 +311,31 @@ func (gs *GameService) RemoveGame(gameID string) {
 		}
 	}
 	delete(gs.games, gameID)
+	delete(gs.rematchOffers, gameID)
+	delete(gs.moveResults, gameID)
+	delete(gs.paused, gameID)
+	if timer, ok := gs.flagTimers[gameID]; ok {
+		timer.Stop()
+		delete(gs.flagTimers, gameID)
+	}
 }
 
 func (gs *GameService) MarkPlayerDisconnected(playerID string) {
 	gs.gamesMutex.Lock()
 	defer gs.gamesMutex.Unlock()
-	gs.disconnected[playerID] = time.Now()
+	gs.disconnected[playerID] = time.Now().Add(reconnectWindow)
 }
 
+// ReconnectPlayer marks a player as back, which resumes a game reloaded
+// after a restart once both players have returned.
 func (gs *GameService) ReconnectPlayer(playerID string) {
 	gs.gamesMutex.Lock()
 	defer gs.gamesMutex.Unlock()
 	delete(gs.disconnected, playerID)
+
+	if game := gs.games[gs.playerGames[playerID]]; game != nil && game.State == models.GameStatePlaying {
+		gs.resumeIfReady(game, time.Now())
+	}
 }
 
 func (gs *GameService) cleanupDisconnectedPlayers() {
@@ -199,48 +346,60 @@ func (gs *GameService) cleanupDisconnectedPlayers() {
 		gs.gamesMutex.Lock()
 		now := time.Now()
 
-		for playerID, disconnectTime := range gs.disconnected {
-			if now.Sub(disconnectTime) > 30*time.Second {
-				// Player didn't reconnect in time
-				gameID, exists := gs.playerGames[playerID]
-				if exists {
-					game := gs.games[gameID]
-					if game != nil && game.State == models.GameStatePlaying {
-						// Forfeit the game
-						var winner *models.Player
-						if game.Player1.ID == playerID {
-							winner = game.Player2
-						} else {
-							winner = game.Player1
-						}
-
-						game.State = models.GameStateFinished
-						game.Winner = winner
-						endTime := now
-						game.EndTime = &endTime
-
-						gs.saveGameResult(game, "forfeit")
-					}
-				}
-
-				delete(gs.disconnected, playerID)
+		for playerID, deadline := range gs.disconnected {
+			if now.Before(deadline) {
+				continue
+			}
+
+			// Player didn't reconnect in time
+			delete(gs.disconnected, playerID)
+			game := gs.games[gs.playerGames[playerID]]
+			if game == nil || game.State != models.GameStatePlaying {
+				continue
+			}
+
+			opponent := game.Player1
+			if game.Player1.ID == playerID {
+				opponent = game.Player2
 			}
+			game.State = models.GameStateFinished
+			endTime := now
+			game.EndTime = &endTime
+
+			// Nobody came back to a game reloaded after a restart
+			if _, away := gs.disconnected[opponent.ID]; away && gs.paused[game.ID] {
+				gs.saveGameResult(game, models.ReasonAborted)
+				continue
+			}
+
+			// Forfeit the game
+			game.Winner = opponent
+			gs.saveGameResult(game, models.ReasonForfeit)
 		}
 
 		gs.gamesMutex.Unlock()
 	}
 }
 
+// saveGameResult records a finished game and announces its end. Must be
+// called with gamesMutex held.
 func (gs *GameService) saveGameResult(game *models.Game, reason string) {
+	game.EndReason = reason
+	delete(gs.paused, game.ID)
 	duration := int(game.EndTime.Sub(game.StartTime).Seconds())
 
-	// Count total moves
-	totalMoves := 0
-	for r := 0; r < models.Rows; r++ {
-		for c := 0; c < models.Columns; c++ {
-			if game.Board[r][c] != 0 {
-				totalMoves++
-			}
+	totalMoves := len(game.Moves)
+
+	moves, err := json.Marshal(game.Moves)
+	if err != nil {
+		log.Printf("Failed to encode move history: %v", err)
+		moves = []byte("[]")
+	}
+
+	botLevel, botName := "", ""
+	for _, p := range []*models.Player{game.Player1, game.Player2} {
+		if p.IsBot && p.Bot != nil {
+			botLevel, botName = string(p.Bot.Level), p.Bot.Name
 		}
 	}
 
@@ -250,18 +409,57 @@ func (gs *GameService) saveGameResult(game *models.Game, reason string) {
 		winnerName = game.Winner.Username
 	}
 
-	_, err := gs.db.Exec(`
-		INSERT INTO games (id, player1, player2, winner, duration, total_moves, completed_at, player1_is_bot, player2_is_bot)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	seriesID := ""
+	if game.Series != nil {
+		seriesID = game.Series.ID
+	}
+
+	_, err = gs.db.Exec(`
+		INSERT INTO games (id, player1, player2, winner, duration, total_moves, completed_at, player1_is_bot, player2_is_bot, variant, moves, bot_level, bot_name, rated, series_id, time_control, end_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`, game.ID, game.Player1.Username, game.Player2.Username, winnerName, duration, totalMoves, time.Now(),
-		game.Player1.IsBot, game.Player2.IsBot)
+		game.Player1.IsBot, game.Player2.IsBot, game.Rules.Variant, string(moves), botLevel, botName, game.Rated, seriesID,
+		game.TimeControl.String(), reason)
 
 	if err != nil {
 		log.Printf("Failed to save game result: %v", err)
 	}
 
+	// Aborted games don't count for anyone
+	if reason != models.ReasonAborted {
+		gs.recordResult(game)
+	}
+
+	// Send Kafka event
+	if gs.kafkaEnabled && gs.kafka != nil {
+		gs.kafka.SendEvent(GameEndEvent{
+			Type:       "game_end",
+			GameID:     game.ID,
+			Winner:     winnerName,
+			Duration:   duration,
+			TotalMoves: totalMoves,
+			Reason:     reason,
+			BotLevel:   botLevel,
+			BotName:    botName,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	gs.publish(EventGameOver, game)
+}
+
+// recordResult counts a finished game towards its series, the leaderboard
+// and the players' ratings, and queues it for analysis.
+func (gs *GameService) recordResult(game *models.Game) {
+	// Count the game towards its series, if any
+	gs.recordSeriesGame(game)
+
+	// Grade the moves in the background
+	gs.analysis.Enqueue(CloneGame(game))
+
 	// Update leaderboard
 	if game.Winner != nil {
+		winnerName := game.Winner.Username
 		loserName := game.Player1.Username
 		if game.Winner.ID == game.Player1.ID {
 			loserName = game.Player2.Username
@@ -292,18 +490,8 @@ func (gs *GameService) saveGameResult(game *models.Game, reason string) {
 		}
 	}
 
-	// Send Kafka event
-	if gs.kafkaEnabled && gs.kafka != nil {
-		gs.kafka.SendEvent(GameEndEvent{
-			Type:       "game_end",
-			GameID:     game.ID,
-			Winner:     winnerName,
-			Duration:   duration,
-			TotalMoves: totalMoves,
-			Reason:     reason,
-			Timestamp:  time.Now(),
-		})
-	}
+	// Rated games also move the players' ratings
+	gs.ratings.RecordGame(game)
 }
 
 func (gs *GameService) updateLeaderboard(username string, result string) {
@@ -341,11 +529,168 @@ func (gs *GameService) updateLeaderboard(username string, result string) {
 	}
 }
 
+// GetGameAnalysis returns the post-game report for a finished game, or
+// ErrAnalysisPending while it is still being worked out.
+func (gs *GameService) GetGameAnalysis(gameID string) (*models.GameAnalysis, error) {
+	return gs.analysis.GetAnalysis(gameID)
+}
+
+// Ratings returns the rating service.
+func (gs *GameService) Ratings() *RatingService {
+	return gs.ratings
+}
+
+// Bots returns the registry of bot implementations, so callers can add
+// their own strategies.
+func (gs *GameService) Bots() *BotRegistry {
+	return gs.bots
+}
+
+// BotSpecForLevel picks the implementation for a new bot player. Levels with
+// an external engine configured use it, then levels set to use MCTS; the
+// rest use the built-in bot.
+func (gs *GameService) BotSpecForLevel(level models.BotLevel) *models.BotSpec {
+	name := BotBuiltin
+	switch {
+	case gs.engines[level] != nil:
+		name = BotEngine
+	case gs.mctsLevels[level]:
+		name = BotMCTS
+	}
+	return &models.BotSpec{Name: name, Level: level}
+}
+
+// ChooseBotMove asks the bot whose turn it is for a column. The bot works on
+// a snapshot of the game, so the game isn't locked while it thinks.
+func (gs *GameService) ChooseBotMove(ctx context.Context, gameID string) (int, error) {
+	gs.gamesMutex.RLock()
+	game, exists := gs.games[gameID]
+	if !exists {
+		gs.gamesMutex.RUnlock()
+		return -1, ErrGameNotFound
+	}
+
+	botPlayer := game.Player1
+	if game.CurrentTurn == 2 {
+		botPlayer = game.Player2
+	}
+	if botPlayer == nil || !botPlayer.IsBot || game.State != models.GameStatePlaying {
+		gs.gamesMutex.RUnlock()
+		return -1, ErrNotBotTurn
+	}
+
+	spec := models.BotSpec{Name: BotBuiltin}
+	if botPlayer.Bot != nil {
+		spec = *botPlayer.Bot
+	}
+	playerNum := game.CurrentTurn
+	snapshot := CloneGame(game)
+	gs.gamesMutex.RUnlock()
+
+	bot, err := gs.bots.New(playerNum, spec)
+	if err != nil {
+		return -1, err
+	}
+	return bot.ChooseMove(ctx, snapshot)
+}
+
+// RequestHint evaluates the position for a player whose turn it is. The
+// hint is counted against the player's allowance before the evaluation
+// starts, so a player can only have one hint worked out at a time, and is
+// given back if no hint comes of it. The evaluation runs on a copy of the
+// game for at most hintTimeout, and its result is dropped if a move was
+// made meanwhile.
+func (gs *GameService) RequestHint(ctx context.Context, gameID string, playerID string) (models.HintPayload, error) {
+	gs.gamesMutex.Lock()
+	game, exists := gs.games[gameID]
+	if !exists {
+		gs.gamesMutex.Unlock()
+		return models.HintPayload{}, ErrGameNotFound
+	}
+
+	playerNum, err := hintPlayerNum(game, playerID)
+	if err != nil {
+		gs.gamesMutex.Unlock()
+		return models.HintPayload{}, err
+	}
+	game.Hints.Used[playerNum-1]++
+	game.Hints.Thinking[playerNum-1] = true
+	snapshot := CloneGame(game)
+	gs.gamesMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, hintTimeout)
+	hint, err := EvaluateMoves(ctx, snapshot)
+	cancel()
+
+	gs.gamesMutex.Lock()
+	game.Hints.Thinking[playerNum-1] = false
+	if err == nil && (game.State != models.GameStatePlaying || len(game.Moves) != len(snapshot.Moves)) {
+		err = ErrStaleHint
+	}
+	if err != nil {
+		game.Hints.Used[playerNum-1]--
+		gs.gamesMutex.Unlock()
+		return models.HintPayload{}, err
+	}
+	game.Hints.Pending[playerNum-1] = true
+	hint.HintsLeft = game.Hints.Remaining(playerNum)
+	used := game.Hints.Used[playerNum-1]
+	username := game.Player1.Username
+	if playerNum == 2 {
+		username = game.Player2.Username
+	}
+	gs.gamesMutex.Unlock()
+
+	if gs.kafkaEnabled && gs.kafka != nil {
+		gs.kafka.SendEvent(HintEvent{
+			Type:       "hint_requested",
+			GameID:     gameID,
+			Player:     username,
+			MoveNumber: len(snapshot.Moves) + 1,
+			Column:     hint.Column,
+			Exact:      hint.Exact,
+			HintsUsed:  used,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	return hint, nil
+}
+
+// hintPlayerNum checks that a player may take a hint now and returns their
+// player number. The caller must hold the games lock.
+func hintPlayerNum(game *models.Game, playerID string) (int, error) {
+	playerNum := 0
+	if game.Player1.ID == playerID {
+		playerNum = 1
+	} else if game.Player2 != nil && game.Player2.ID == playerID {
+		playerNum = 2
+	}
+
+	switch {
+	case playerNum == 0:
+		return 0, ErrNotInGame
+	case game.State != models.GameStatePlaying:
+		return 0, ErrGameOver
+	case game.CurrentTurn != playerNum:
+		return 0, ErrNotYourTurn
+	case game.Hints.Limit == 0:
+		return 0, ErrHintsDisabled
+	case game.Hints.Thinking[playerNum-1]:
+		return 0, ErrHintPending
+	case game.Hints.Remaining(playerNum) == 0:
+		return 0, ErrNoHintsLeft
+	}
+	return playerNum, nil
+}
+
+// GetLeaderboard returns the top 10 players by rating, each with their
+// recent rating history.
 func (gs *GameService) GetLeaderboard() ([]models.LeaderboardEntry, error) {
 	rows, err := gs.db.Query(`
-		SELECT username, wins, losses, draws
+		SELECT username, wins, losses, draws, rating, rating_deviation, rating_volatility
 		FROM leaderboard
-		ORDER BY wins DESC
+		ORDER BY rating DESC, wins DESC
 		LIMIT 10
 	`)
 	if err != nil {
@@ -356,12 +701,23 @@ func (gs *GameService) GetLeaderboard() ([]models.LeaderboardEntry, error) {
 	var leaderboard []models.LeaderboardEntry
 	for rows.Next() {
 		var entry models.LeaderboardEntry
-		if err := rows.Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws); err != nil {
+		if err := rows.Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws,
+			&entry.Rating, &entry.Deviation, &entry.Volatility); err != nil {
 			continue
 		}
+		entry.Provisional = IsProvisional(models.Rating{Rating: entry.Rating, Deviation: entry.Deviation})
 		leaderboard = append(leaderboard, entry)
 	}
 
+	for i := range leaderboard {
+		history, err := gs.ratings.History(leaderboard[i].Username, ratingHistoryLength)
+		if err != nil {
+			log.Printf("Failed to load rating history for %s: %v", leaderboard[i].Username, err)
+			history = []models.RatingPoint{}
+		}
+		leaderboard[i].History = history
+	}
+
 	return leaderboard, nil
 }
 
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// reconnectWindow is how long a player who dropped out of a game has to
+	// come back before forfeiting it.
+	reconnectWindow = 30 * time.Second
+
+	// recoveryWindow is how long players have to come back to games that
+	// were reloaded after a restart.
+	recoveryWindow = 2 * time.Minute
+)
+
+var ErrGamePaused = errors.New("waiting for both players to reconnect")
+
+// savedGame is how a game is stored: the game itself, plus the players'
+// sessions, which the game's JSON leaves out.
+type savedGame struct {
+	Game     *models.Game `json:"game"`
+	Sessions [2]string    `json:"sessions"`
+}
+
+// gameStore keeps the state of games in progress in Postgres, so they
+// survive a restart. Snapshots are written in the background; if a game
+// changes again before its last snapshot is written, only the newest one
+// is.
+type gameStore struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	pending map[string]*models.Game // gameID -> snapshot not yet written
+	wake    chan struct{}
+}
+
+func newGameStore(db *sql.DB) *gameStore {
+	s := &gameStore{
+		db:      db,
+		pending: make(map[string]*models.Game),
+		wake:    make(chan struct{}, 1),
+	}
+	go s.run()
+	return s
+}
+
+// save queues a snapshot of a game for writing. Snapshots of finished
+// games remove the game from the store. The snapshot must not change
+// afterwards.
+func (s *gameStore) save(snapshot *models.Game) {
+	s.mu.Lock()
+	s.pending[snapshot.ID] = snapshot
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *gameStore) run() {
+	for range s.wake {
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = make(map[string]*models.Game)
+		s.mu.Unlock()
+
+		for _, game := range batch {
+			if err := s.write(game); err != nil {
+				log.Printf("Failed to save state of game %s: %v", game.ID, err)
+			}
+		}
+	}
+}
+
+func (s *gameStore) write(game *models.Game) error {
+	if game.State != models.GameStatePlaying {
+		_, err := s.db.Exec(`DELETE FROM active_games WHERE id = $1`, game.ID)
+		return err
+	}
+
+	state, err := json.Marshal(savedGame{Game: game, Sessions: game.Sessions})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO active_games (id, state, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at
+	`, game.ID, string(state), time.Now())
+	return err
+}
+
+// load returns the games that were in progress when the server stopped.
+// Games whose result was recorded before their state was cleared are
+// dropped.
+func (s *gameStore) load() ([]*models.Game, error) {
+	if _, err := s.db.Exec(`DELETE FROM active_games WHERE id IN (SELECT id FROM games)`); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT state FROM active_games`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []*models.Game
+	for rows.Next() {
+		var state []byte
+		if err := rows.Scan(&state); err != nil {
+			return nil, err
+		}
+
+		var saved savedGame
+		if err := json.Unmarshal(state, &saved); err != nil || saved.Game == nil {
+			log.Printf("Skipping unreadable saved game: %v", err)
+			continue
+		}
+		saved.Game.Sessions = saved.Sessions
+		games = append(games, saved.Game)
+	}
+	return games, rows.Err()
+}
+
+// recoverGames reloads the games that were in progress when the server
+// stopped. Each game is paused until its human players have reconnected;
+// players who don't come back within recoveryWindow forfeit, and a game
+// neither player returns to is aborted.
+func (gs *GameService) recoverGames() {
+	games, err := gs.store.load()
+	if err != nil {
+		log.Printf("Failed to load saved games: %v", err)
+		return
+	}
+
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	now := time.Now()
+	for _, game := range games {
+		gs.games[game.ID] = game
+		gs.paused[game.ID] = true
+
+		for _, player := range []*models.Player{game.Player1, game.Player2} {
+			gs.playerGames[player.ID] = game.ID
+			if !player.IsBot {
+				gs.disconnected[player.ID] = now.Add(recoveryWindow)
+			}
+		}
+
+		// Bot-only games carry on straight away
+		gs.resumeIfReady(game, now)
+	}
+
+	if len(games) > 0 {
+		log.Printf("Recovered %d games in progress", len(games))
+	}
+}
+
+// resumeIfReady restarts a paused game once none of its human players are
+// still away. The player to move starts their turn afresh, so the time the
+// server was down isn't charged to them. Must be called with gamesMutex
+// held.
+func (gs *GameService) resumeIfReady(game *models.Game, now time.Time) {
+	if !gs.paused[game.ID] {
+		return
+	}
+	for _, player := range []*models.Player{game.Player1, game.Player2} {
+		if _, away := gs.disconnected[player.ID]; away {
+			return
+		}
+	}
+
+	delete(gs.paused, game.ID)
+	if game.Clock != nil {
+		game.Clock.TurnStartedAt = now
+	}
+	log.Printf("Game %s resumed", game.ID)
+	gs.publish(EventGameResumed, game)
+}
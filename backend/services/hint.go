@@ -0,0 +1,212 @@
+package services
+
+import (
+	"connect-four-backend/engine"
+	"connect-four-backend/models"
+	"connect-four-backend/solver"
+	"context"
+	"os"
+	"strconv"
+	"time"
+)
+
+// hintDepth is the lookahead used to estimate positions the solver can't
+// settle in time.
+const hintDepth = 6
+
+// defaultHintLimit is how many hints each player gets in a casual game.
+const defaultHintLimit = 3
+
+// hintTimeout bounds the work on one hint: waiting for a solver, solving
+// and the lookahead fallback.
+const hintTimeout = 2 * perfectThinkTime
+
+// Outcomes reported in a ColumnEvaluation.
+const (
+	OutcomeWin     = "win"
+	OutcomeLoss    = "loss"
+	OutcomeDraw    = "draw"
+	OutcomeUnclear = "unclear"
+)
+
+// HintLimitFromEnv reads HINTS_PER_GAME, the number of hints each player
+// may ask for in a casual game. Zero turns hints off everywhere.
+func HintLimitFromEnv() int {
+	limit, err := strconv.Atoi(os.Getenv("HINTS_PER_GAME"))
+	if err != nil || limit < 0 {
+		return defaultHintLimit
+	}
+	return limit
+}
+
+// EvaluateMoves rates every playable column for the player to move and
+// suggests the best one. Standard boards are solved exactly if the solver
+// finishes within perfectThinkTime; otherwise, or if no solver comes free
+// in that time, the columns are estimated with a lookahead search. The game
+// is only read, so callers should pass a copy if it might change meanwhile.
+func EvaluateMoves(ctx context.Context, game *models.Game) (models.HintPayload, error) {
+	if game.State == models.GameStateFinished {
+		return models.HintPayload{}, ErrNoValidMove
+	}
+
+	// Time spent waiting for a solver comes out of the solver's time
+	started := time.Now()
+	waitCtx, cancel := context.WithTimeout(ctx, perfectThinkTime)
+	s, err := perfectSolvers.acquire(waitCtx)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		return models.HintPayload{}, ctx.Err()
+	}
+	if s != nil {
+		defer perfectSolvers.release(s)
+	}
+	return evaluateMoves(ctx, game, s, perfectThinkTime-time.Since(started))
+}
+
+// evaluateMoves does the work for EvaluateMoves with the given solver and
+// time limit. Without a solver the columns are always estimated.
+func evaluateMoves(ctx context.Context, game *models.Game, s *solver.Solver, thinkTime time.Duration) (models.HintPayload, error) {
+	if IsBoardFull(game) {
+		return models.HintPayload{}, ErrNoValidMove
+	}
+
+	if hint, ok := solvedHint(ctx, game, s, thinkTime); ok {
+		return hint, nil
+	}
+
+	pos, err := positionOf(game)
+	if err != nil {
+		return boardHint(ctx, game)
+	}
+	return searchedHint(pos, game.CurrentTurn), nil
+}
+
+// solvedHint asks the solver, reporting false if there is none, the board
+// isn't standard or the search runs out of time.
+func solvedHint(ctx context.Context, game *models.Game, s *solver.Solver, thinkTime time.Duration) (models.HintPayload, bool) {
+	if s == nil {
+		return models.HintPayload{}, false
+	}
+
+	pos, err := solver.FromGame(game)
+	if err != nil {
+		return models.HintPayload{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, thinkTime)
+	defer cancel()
+
+	results, err := s.Analyze(ctx, pos)
+	if err != nil {
+		return models.HintPayload{}, false
+	}
+
+	hint := models.HintPayload{Exact: true}
+	for _, r := range results {
+		hint.Evaluations = append(hint.Evaluations, models.ColumnEvaluation{
+			Column:  r.Column,
+			Outcome: string(r.Result.Outcome),
+			Score:   r.Result.Score,
+		})
+	}
+	hint.Column = bestEvaluated(hint.Evaluations, game.Rules.Columns)
+	return hint, true
+}
+
+// searchedHint scores each column with a full-window lookahead, so that
+// every score is exact up to the search depth rather than just a bound.
+func searchedHint(pos engine.Position, player int) models.HintPayload {
+	order := centerOrder(pos.Columns())
+	bound := winScore + hintDepth + 1
+
+	var hint models.HintPayload
+	for col := 0; col < pos.Columns(); col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		eval := models.ColumnEvaluation{Column: col, Outcome: OutcomeUnclear}
+		if pos.IsWinningMove(col, player) {
+			eval.Outcome, eval.Score = OutcomeWin, winScore+hintDepth
+		} else {
+			next := pos
+			next.Play(col, player)
+			eval.Score = -negamax(&next, 3-player, hintDepth-1, -bound, bound, order)
+
+			switch {
+			case eval.Score > winScore/2:
+				eval.Outcome = OutcomeWin
+			case eval.Score < -winScore/2:
+				eval.Outcome = OutcomeLoss
+			case next.IsFull():
+				eval.Outcome = OutcomeDraw
+			}
+		}
+
+		hint.Evaluations = append(hint.Evaluations, eval)
+	}
+
+	hint.Column = bestEvaluated(hint.Evaluations, pos.Columns())
+	return hint
+}
+
+// boardHint handles boards too large for a bitboard. It only looks one
+// move ahead for each side: columns that win at once and columns that let
+// the opponent win at once. The suggestion comes from the hard bot.
+func boardHint(ctx context.Context, game *models.Game) (models.HintPayload, error) {
+	var hint models.HintPayload
+	for col := 0; col < game.Rules.Columns; col++ {
+		if !IsValidMove(game, col) {
+			continue
+		}
+
+		eval := models.ColumnEvaluation{Column: col, Outcome: OutcomeUnclear}
+		next := CloneGame(game)
+		MakeMove(next, col, game.CurrentTurn)
+		if hasWon, _, _ := CheckWinner(next); hasWon {
+			eval.Outcome, eval.Score = OutcomeWin, 1
+		} else if IsBoardFull(next) {
+			eval.Outcome = OutcomeDraw
+		} else if opponentCanWin(next, 3-game.CurrentTurn) {
+			eval.Outcome, eval.Score = OutcomeLoss, -1
+		}
+
+		hint.Evaluations = append(hint.Evaluations, eval)
+	}
+
+	col, err := NewBuiltinBot(game.CurrentTurn, models.BotLevelHard).ChooseMove(ctx, game)
+	if err != nil {
+		return models.HintPayload{}, err
+	}
+	hint.Column = col
+	return hint, nil
+}
+
+// opponentCanWin reports whether player has a winning move on the board.
+func opponentCanWin(game *models.Game, player int) bool {
+	for col := 0; col < game.Rules.Columns; col++ {
+		if !IsValidMove(game, col) {
+			continue
+		}
+		next := CloneGame(game)
+		MakeMove(next, col, player)
+		if hasWon, _, _ := CheckWinner(next); hasWon {
+			return true
+		}
+	}
+	return false
+}
+
+// bestEvaluated returns the highest scoring column, preferring central
+// columns among equal scores.
+func bestEvaluated(evals []models.ColumnEvaluation, columns int) int {
+	best, bestScore := -1, 0
+	for _, col := range centerOrder(columns) {
+		for _, eval := range evals {
+			if eval.Column == col && (best == -1 || eval.Score > bestScore) {
+				best, bestScore = col, eval.Score
+			}
+		}
+	}
+	return best
+}
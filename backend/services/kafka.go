@@ -92,13 +92,14 @@ func (kp *KafkaProducer) Close() error {
 
 // Event types
 type GameStartEvent struct {
-	Type       string    `json:"type"`
-	GameID     string    `json:"gameId"`
-	Player1    string    `json:"player1"`
-	Player2    string    `json:"player2"`
-	Player1Bot bool      `json:"player1Bot"`
-	Player2Bot bool      `json:"player2Bot"`
-	Timestamp  time.Time `json:"timestamp"`
+	Type        string    `json:"type"`
+	GameID      string    `json:"gameId"`
+	Player1     string    `json:"player1"`
+	Player2     string    `json:"player2"`
+	Player1Bot  bool      `json:"player1Bot"`
+	Player2Bot  bool      `json:"player2Bot"`
+	TimeControl string    `json:"timeControl,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
 }
 
 type GameMoveEvent struct {
@@ -107,6 +108,7 @@ type GameMoveEvent struct {
 	Player    string    `json:"player"`
 	Column    int       `json:"column"`
 	Row       int       `json:"row"`
+	HintUsed  bool      `json:"hintUsed,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
@@ -117,6 +119,19 @@ type GameEndEvent struct {
 	Duration   int       `json:"duration"`
 	TotalMoves int       `json:"totalMoves"`
 	Reason     string    `json:"reason"`
+	BotLevel   string    `json:"botLevel,omitempty"`
+	BotName    string    `json:"botName,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type HintEvent struct {
+	Type       string    `json:"type"`
+	GameID     string    `json:"gameId"`
+	Player     string    `json:"player"`
+	MoveNumber int       `json:"moveNumber"` // the move the hint was for
+	Column     int       `json:"column"`     // suggested column
+	Exact      bool      `json:"exact"`
+	HintsUsed  int       `json:"hintsUsed"` // by this player so far
 	Timestamp  time.Time `json:"timestamp"`
 }
 
@@ -3,38 +3,127 @@ package services
 import (
 	"connect-four-backend/models"
 	"log"
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
 
+// Matchmaking tuning. A player's acceptable rating gap starts narrow and
+// widens the longer they wait. If nobody suitable turns up they get a bot,
+// after a wait that grows with the number of other players queueing for
+// the same kind of game, since a human opponent is then more likely. A
+// player who sat out a busy queue that way gets a bot a level easier.
+const (
+	initialRatingGap   = 100.0
+	ratingGapPerSecond = 50.0
+	maxRatingGap       = 1000.0
+
+	baseBotFallback    = 10 * time.Second
+	botFallbackPerPeer = 2 * time.Second
+	maxBotFallback     = 30 * time.Second
+
+	// busyQueuePeers is how many others queueing for the same kind of game
+	// make the queue busy enough to ease the bot's level.
+	busyQueuePeers = 3
+
+	// rematchCooldown keeps two players who just played each other from
+	// being paired again straight away.
+	rematchCooldown = 2 * time.Minute
+)
+
+// MaxQueueWait is the longest a player can wait before being matched,
+// with a human or a bot.
+const MaxQueueWait = maxBotFallback
+
+// Clock tells the matchmaker the time, so tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the real wall clock.
+var SystemClock Clock = systemClock{}
+
+// RatingSource looks up players' current ratings.
+type RatingSource interface {
+	GetRating(username string) (models.Rating, error)
+}
+
+// GameStarter starts the games matchmaking arranges. GameService is the
+// real one.
+type GameStarter interface {
+	CreateGame(player *models.Player, opts GameOptions) *models.Game
+	JoinGame(game *models.Game, player *models.Player)
+	BotSpecForLevel(level models.BotLevel) *models.BotSpec
+}
+
+// QueueOptions describes the game a player is queueing for.
+type QueueOptions struct {
+	Rules       models.Rules
+	BotLevel    models.BotLevel // bot difficulty if no opponent is found; "" picks one from the rating
+	Rated       bool
+	TimeControl models.TimeControl
+}
+
 type WaitingPlayer struct {
-	Player    *models.Player
-	Timestamp time.Time
+	Player      *models.Player
+	Rules       models.Rules
+	BotLevel    models.BotLevel
+	Rated       bool
+	TimeControl models.TimeControl
+	Rating      models.Rating
+	Timestamp   time.Time
+}
+
+type recentMatch struct {
+	opponent string
+	at       time.Time
 }
 
 type MatchmakingService struct {
-	queue       []*WaitingPlayer
-	queueMutex  sync.Mutex
-	gameService *GameService
+	queue      []*WaitingPlayer
+	queueMutex sync.Mutex
+	games      GameStarter
+	ratings    RatingSource
+	clock      Clock
+	recent     map[string]recentMatch // username -> last opponent
 }
 
-func NewMatchmakingService(gameService *GameService) *MatchmakingService {
+func NewMatchmakingService(games GameStarter, ratings RatingSource, clock Clock) *MatchmakingService {
 	return &MatchmakingService{
-		queue:       make([]*WaitingPlayer, 0),
-		gameService: gameService,
+		queue:   make([]*WaitingPlayer, 0),
+		games:   games,
+		ratings: ratings,
+		clock:   clock,
+		recent:  make(map[string]recentMatch),
 	}
 }
 
-func (ms *MatchmakingService) AddToQueue(player *models.Player) {
+func (ms *MatchmakingService) AddToQueue(player *models.Player, opts QueueOptions) {
+	rating, err := ms.ratings.GetRating(player.Username)
+	if err != nil {
+		log.Printf("Failed to load rating for %s: %v", player.Username, err)
+		rating = DefaultRating()
+	}
+
 	ms.queueMutex.Lock()
 	defer ms.queueMutex.Unlock()
 
 	ms.queue = append(ms.queue, &WaitingPlayer{
-		Player:    player,
-		Timestamp: time.Now(),
+		Player:      player,
+		Rules:       opts.Rules,
+		BotLevel:    opts.BotLevel,
+		Rated:       opts.Rated,
+		TimeControl: opts.TimeControl,
+		Rating:      rating,
+		Timestamp:   ms.clock.Now(),
 	})
 
-	log.Printf("Player %s added to queue. Queue size: %d", player.Username, len(ms.queue))
+	log.Printf("Player %s (%.0f) added to %s queue. Queue size: %d", player.Username, rating.Rating, opts.Rules.Variant, len(ms.queue))
 }
 
 func (ms *MatchmakingService) RemoveFromQueue(playerID string) {
@@ -67,52 +156,85 @@ func (ms *MatchmakingService) processQueue() {
 		return
 	}
 
-	now := time.Now()
+	now := ms.clock.Now()
+	ms.forgetOldMatches(now)
 	processed := make(map[int]bool)
 
-	// Try to match players
-	for i := 0; i < len(ms.queue); i++ {
+	// Longest waiting players pick first
+	order := make([]int, len(ms.queue))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return ms.queue[order[a]].Timestamp.Before(ms.queue[order[b]].Timestamp)
+	})
+
+	for _, i := range order {
 		if processed[i] {
 			continue
 		}
-
 		wp1 := ms.queue[i]
 
-		// Check if player has been waiting for more than 10 seconds
-		if now.Sub(wp1.Timestamp) > 10*time.Second {
-			// Match with bot
-			log.Printf("Matching %s with bot (waited %v)", wp1.Player.Username, now.Sub(wp1.Timestamp))
+		// Find the closest rated opponent within the wider of the two
+		// players' windows
+		best, bestGap := -1, math.Inf(1)
+		for j, wp2 := range ms.queue {
+			if j == i || processed[j] || !ms.canPair(wp1, wp2, now) {
+				continue
+			}
 
-			botPlayer := &models.Player{
-				ID:       GeneratePlayerID(),
-				Username: "Bot",
-				IsBot:    true,
+			gap := math.Abs(wp1.Rating.Rating - wp2.Rating.Rating)
+			window := math.Max(RatingWindow(now.Sub(wp1.Timestamp)), RatingWindow(now.Sub(wp2.Timestamp)))
+			if gap <= window && gap < bestGap {
+				best, bestGap = j, gap
 			}
+		}
+
+		if best != -1 {
+			wp2 := ms.queue[best]
+			log.Printf("Matching %s (%.0f) with %s (%.0f)", wp1.Player.Username, wp1.Rating.Rating, wp2.Player.Username, wp2.Rating.Rating)
 
-			game := ms.gameService.CreateGame(wp1.Player)
-			ms.gameService.JoinGame(game, botPlayer)
+			game := ms.games.CreateGame(wp1.Player, GameOptions{
+				Rules:       wp1.Rules,
+				Rated:       wp1.Rated,
+				TimeControl: wp1.TimeControl,
+			})
+			ms.games.JoinGame(game, wp2.Player)
+			ms.remember(wp1.Player.Username, wp2.Player.Username, now)
 
 			processed[i] = true
+			processed[best] = true
 			continue
 		}
 
-		// Try to match with another player
-		for j := i + 1; j < len(ms.queue); j++ {
-			if processed[j] {
-				continue
-			}
+		// Nobody suitable: fall back to a bot once the player has waited
+		// long enough
+		peers := ms.peers(i, processed)
+		if now.Sub(wp1.Timestamp) < BotFallbackAfter(peers, wp1.Rating) {
+			continue
+		}
 
-			wp2 := ms.queue[j]
+		level := wp1.BotLevel
+		if level == "" {
+			level = BotLevelForQueue(wp1.Rating, peers)
+		}
+		log.Printf("Matching %s with %s bot (waited %v, %d others queueing)", wp1.Player.Username, level, now.Sub(wp1.Timestamp), peers)
 
-			log.Printf("Matching %s with %s", wp1.Player.Username, wp2.Player.Username)
+		botPlayer := &models.Player{
+			ID:       GeneratePlayerID(),
+			Username: "Bot",
+			IsBot:    true,
+			Bot:      ms.games.BotSpecForLevel(level),
+		}
 
-			game := ms.gameService.CreateGame(wp1.Player)
-			ms.gameService.JoinGame(game, wp2.Player)
+		game := ms.games.CreateGame(wp1.Player, GameOptions{
+			Rules:       wp1.Rules,
+			Rated:       wp1.Rated,
+			TimeControl: wp1.TimeControl,
+		})
+		ms.games.JoinGame(game, botPlayer)
 
-			processed[i] = true
-			processed[j] = true
-			break
-		}
+		processed[i] = true
 	}
 
 	// Remove processed players from queue
@@ -124,3 +246,103 @@ func (ms *MatchmakingService) processQueue() {
 	}
 	ms.queue = newQueue
 }
+
+// canPair checks everything but the rating gap: both players want the same
+// kind of game and neither of them last played the other within the
+// cooldown.
+func (ms *MatchmakingService) canPair(wp1, wp2 *WaitingPlayer, now time.Time) bool {
+	if !sameKindOfGame(wp1, wp2) {
+		return false
+	}
+	if wp1.Player.Username == wp2.Player.Username {
+		return false
+	}
+	return !ms.playedRecently(wp1.Player.Username, wp2.Player.Username, now) &&
+		!ms.playedRecently(wp2.Player.Username, wp1.Player.Username, now)
+}
+
+// playedRecently reports whether a player's last opponent, within the
+// cooldown, was the given one.
+func (ms *MatchmakingService) playedRecently(username, opponent string, now time.Time) bool {
+	last, ok := ms.recent[username]
+	return ok && last.opponent == opponent && now.Sub(last.at) < rematchCooldown
+}
+
+// peers counts the other players still queueing for the same kind of game
+// as the player at index i.
+func (ms *MatchmakingService) peers(i int, processed map[int]bool) int {
+	wp := ms.queue[i]
+	count := 0
+	for j, other := range ms.queue {
+		if j != i && !processed[j] && sameKindOfGame(wp, other) {
+			count++
+		}
+	}
+	return count
+}
+
+// sameKindOfGame reports whether two players queue for the same board,
+// rating setting and time control, each of which splits the queue.
+func sameKindOfGame(wp1, wp2 *WaitingPlayer) bool {
+	return wp1.Rules == wp2.Rules && wp1.Rated == wp2.Rated && wp1.TimeControl == wp2.TimeControl
+}
+
+func (ms *MatchmakingService) remember(player1, player2 string, now time.Time) {
+	ms.recent[player1] = recentMatch{opponent: player2, at: now}
+	ms.recent[player2] = recentMatch{opponent: player1, at: now}
+}
+
+func (ms *MatchmakingService) forgetOldMatches(now time.Time) {
+	for username, match := range ms.recent {
+		if now.Sub(match.at) >= rematchCooldown {
+			delete(ms.recent, username)
+		}
+	}
+}
+
+// RatingWindow is the largest rating gap a player accepts after waiting
+// for the given time.
+func RatingWindow(waited time.Duration) float64 {
+	return math.Min(maxRatingGap, initialRatingGap+ratingGapPerSecond*waited.Seconds())
+}
+
+// BotFallbackAfter is how long a player waits for a human opponent before
+// getting a bot. Every other player queueing for the same kind of game adds
+// a little, since one of them may soon be in range. Players whose rating is
+// still provisional, or far from where most players are, are unlikely to
+// find a close match and get the base wait.
+func BotFallbackAfter(peers int, rating models.Rating) time.Duration {
+	if !waitsForPeers(rating) {
+		return baseBotFallback
+	}
+
+	wait := baseBotFallback + time.Duration(peers)*botFallbackPerPeer
+	if wait > maxBotFallback {
+		wait = maxBotFallback
+	}
+	return wait
+}
+
+// BotLevelForQueue picks the bot level for a player who found no opponent
+// while peers others queued for the same kind of game. It is the level for
+// the player's rating, one easier if the player waited out a busy queue.
+func BotLevelForQueue(rating models.Rating, peers int) models.BotLevel {
+	level := BotLevelForRating(rating)
+	if peers < busyQueuePeers || !waitsForPeers(rating) {
+		return level
+	}
+
+	for i := 1; i < len(botLevelOrder); i++ {
+		if botLevelOrder[i] == level {
+			return botLevelOrder[i-1]
+		}
+	}
+	return level
+}
+
+// waitsForPeers reports whether a player's bot fallback waits longer for
+// other players in the queue. Provisional ratings and ratings far from where
+// most players are don't.
+func waitsForPeers(rating models.Rating) bool {
+	return !IsProvisional(rating) && math.Abs(rating.Rating-defaultRating) <= maxRatingGap/2
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+type fakeRatings map[string]models.Rating
+
+func (r fakeRatings) GetRating(username string) (models.Rating, error) {
+	if rating, ok := r[username]; ok {
+		return rating, nil
+	}
+	return DefaultRating(), nil
+}
+
+// fakeGames records the games matchmaking starts instead of playing them.
+type fakeGames struct {
+	games []*models.Game
+}
+
+func (f *fakeGames) CreateGame(player *models.Player, opts GameOptions) *models.Game {
+	game := models.NewGame(player, opts.Rules)
+	f.games = append(f.games, game)
+	return game
+}
+
+func (f *fakeGames) JoinGame(game *models.Game, player *models.Player) {
+	game.Player2 = player
+	game.State = models.GameStatePlaying
+}
+
+func (f *fakeGames) BotSpecForLevel(level models.BotLevel) *models.BotSpec {
+	return &models.BotSpec{Name: BotBuiltin, Level: level}
+}
+
+func established(rating float64) models.Rating {
+	return models.Rating{Rating: rating, Deviation: 60, Volatility: defaultVolatility}
+}
+
+func newTestMatchmaking(ratings fakeRatings) (*MatchmakingService, *fakeGames, *fakeClock) {
+	games := &fakeGames{}
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return NewMatchmakingService(games, ratings, clock), games, clock
+}
+
+func queue(ms *MatchmakingService, username string) {
+	rules, _ := models.RulesForVariant("")
+	ms.AddToQueue(&models.Player{ID: username, Username: username}, QueueOptions{Rules: rules, Rated: true})
+}
+
+func TestRatingWindowWidensWhileWaiting(t *testing.T) {
+	ms, games, clock := newTestMatchmaking(fakeRatings{
+		"alice": established(1500),
+		"bob":   established(1800),
+	})
+	queue(ms, "alice")
+	queue(ms, "bob")
+
+	// A 300 point gap is in range once the window has grown from 100 by
+	// 50 a second for four seconds
+	for waited := time.Duration(0); waited < 4*time.Second; waited += time.Second {
+		ms.processQueue()
+		if len(games.games) != 0 {
+			t.Fatalf("players 300 apart matched after %v", waited)
+		}
+		clock.advance(time.Second)
+	}
+
+	ms.processQueue()
+	if len(games.games) != 1 {
+		t.Fatalf("got %d games after 4s, want 1", len(games.games))
+	}
+	game := games.games[0]
+	if game.Player1.Username != "alice" || game.Player2.Username != "bob" {
+		t.Errorf("matched %s with %s, want alice with bob", game.Player1.Username, game.Player2.Username)
+	}
+}
+
+func TestClosestOpponentIsPreferred(t *testing.T) {
+	ms, games, clock := newTestMatchmaking(fakeRatings{
+		"alice": established(1500),
+		"bob":   established(1580),
+		"carol": established(1520),
+	})
+	queue(ms, "alice")
+	clock.advance(time.Second)
+	queue(ms, "bob")
+	queue(ms, "carol")
+
+	ms.processQueue()
+	if len(games.games) != 1 {
+		t.Fatalf("got %d games, want 1", len(games.games))
+	}
+	if opponent := games.games[0].Player2.Username; opponent != "carol" {
+		t.Errorf("alice was matched with %s, want carol", opponent)
+	}
+}
+
+func TestBotFallbackAfterTimeout(t *testing.T) {
+	ms, games, clock := newTestMatchmaking(fakeRatings{"alice": established(1500)})
+	queue(ms, "alice")
+
+	clock.advance(baseBotFallback - time.Second)
+	ms.processQueue()
+	if len(games.games) != 0 {
+		t.Fatalf("got a bot after %v, before the fallback", baseBotFallback-time.Second)
+	}
+
+	clock.advance(time.Second)
+	ms.processQueue()
+	if len(games.games) != 1 {
+		t.Fatalf("got %d games after %v, want a bot game", len(games.games), baseBotFallback)
+	}
+
+	bot := games.games[0].Player2
+	if !bot.IsBot || bot.Bot == nil {
+		t.Fatalf("opponent %+v is not a bot", bot)
+	}
+	if want := BotLevelForRating(established(1500)); bot.Bot.Level != want {
+		t.Errorf("bot level %s, want %s", bot.Bot.Level, want)
+	}
+	if len(ms.queue) != 0 {
+		t.Errorf("%d players still queued", len(ms.queue))
+	}
+}
+
+func TestBotFallbackWaitsLongerWithPeers(t *testing.T) {
+	// Too far apart to be matched with each other before the fallback
+	ms, games, clock := newTestMatchmaking(fakeRatings{
+		"alice": established(1050),
+		"bob":   established(1950),
+	})
+	queue(ms, "alice")
+	queue(ms, "bob")
+
+	clock.advance(baseBotFallback)
+	ms.processQueue()
+	if len(games.games) != 0 {
+		t.Fatalf("got %d games at the base fallback with a peer queueing", len(games.games))
+	}
+
+	// Once one of them gets a bot, the other has no peers left and gets one
+	// too
+	clock.advance(botFallbackPerPeer)
+	ms.processQueue()
+	if len(games.games) != 2 {
+		t.Fatalf("got %d games once the wait for one peer passed, want 2", len(games.games))
+	}
+	for _, game := range games.games {
+		if !game.Player2.IsBot {
+			t.Errorf("%s was matched with %s, want a bot", game.Player1.Username, game.Player2.Username)
+		}
+	}
+}
+
+func TestRecentOpponentsAreNotRepaired(t *testing.T) {
+	ms, games, clock := newTestMatchmaking(fakeRatings{
+		"alice": established(1500),
+		"bob":   established(1500),
+		"carol": established(1560),
+	})
+	queue(ms, "alice")
+	queue(ms, "bob")
+	ms.processQueue()
+	if len(games.games) != 1 {
+		t.Fatalf("got %d games, want alice and bob matched", len(games.games))
+	}
+
+	// Straight back in the queue, alice gets carol rather than bob, the
+	// closer rating
+	clock.advance(time.Second)
+	queue(ms, "alice")
+	queue(ms, "bob")
+	queue(ms, "carol")
+	ms.processQueue()
+	if len(games.games) != 2 {
+		t.Fatalf("got %d games, want alice matched again", len(games.games))
+	}
+	if game := games.games[1]; game.Player1.Username != "alice" || game.Player2.Username != "carol" {
+		t.Errorf("matched %s with %s, want alice with carol", game.Player1.Username, game.Player2.Username)
+	}
+	ms.RemoveFromQueue("bob")
+
+	// Alone in the queue together, alice and bob wait out the cooldown
+	clock.advance(rematchCooldown - 5*time.Second)
+	queue(ms, "alice")
+	queue(ms, "bob")
+	ms.processQueue()
+	if len(games.games) != 2 {
+		t.Fatalf("alice and bob were paired again %v after their game", rematchCooldown-5*time.Second)
+	}
+
+	clock.advance(5 * time.Second)
+	ms.processQueue()
+	if len(games.games) != 3 {
+		t.Fatalf("alice and bob weren't paired once the cooldown passed")
+	}
+	if game := games.games[2]; game.Player2.IsBot {
+		t.Errorf("%s got a bot instead of a rematch", game.Player1.Username)
+	}
+}
+
+func TestBotLevelEasesInBusyQueue(t *testing.T) {
+	tests := []struct {
+		name   string
+		rating models.Rating
+		peers  int
+		want   models.BotLevel
+	}{
+		{"quiet queue", established(1700), 0, models.BotLevelHard},
+		{"a few others", established(1700), busyQueuePeers - 1, models.BotLevelHard},
+		{"busy queue", established(1700), busyQueuePeers, models.BotLevelMedium},
+		{"busy queue at the easiest level", established(1050), busyQueuePeers + 2, models.BotLevelEasy},
+		{"provisional rating", DefaultRating(), busyQueuePeers, models.BotLevelMedium},
+		{"rating far from most players", established(2100), busyQueuePeers, models.BotLevelPerfect},
+	}
+
+	for _, tt := range tests {
+		if got := BotLevelForQueue(tt.rating, tt.peers); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
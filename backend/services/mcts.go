@@ -0,0 +1,223 @@
+package services
+
+import (
+	"connect-four-backend/engine"
+	"connect-four-backend/models"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// mctsExploration is the UCT exploration constant, sqrt(2).
+	mctsExploration = 1.41
+
+	// mctsDefaultIterations bounds a search that has neither a think time
+	// nor an iteration limit.
+	mctsDefaultIterations = 10000
+)
+
+// MCTSBot chooses moves with Monte Carlo Tree Search. Instead of fixed
+// priorities it plays out many random games from the current position and
+// picks the move that did best, which makes for a less predictable opponent.
+//
+// Searches are driven by a seeded random source. With MaxIterations set,
+// two bots built with the same seed choose the same moves; with only a
+// ThinkTime the number of playouts depends on machine speed.
+type MCTSBot struct {
+	PlayerNum     int
+	ThinkTime     time.Duration
+	MaxIterations int             // 0 means no limit besides ThinkTime
+	Level         models.BotLevel // level of the built-in bot used on boards too large to search
+	rng           *rand.Rand
+}
+
+// MCTSLevelsFromEnv reads BOT_MCTS_LEVELS, a comma-separated list of the
+// bot levels played by the MCTS bot rather than the built-in one.
+func MCTSLevelsFromEnv() map[models.BotLevel]bool {
+	levels := make(map[models.BotLevel]bool)
+	for _, name := range strings.Split(os.Getenv("BOT_MCTS_LEVELS"), ",") {
+		level := models.BotLevel(strings.TrimSpace(name))
+		if _, ok := botLevels[level]; !ok {
+			continue
+		}
+		levels[level] = true
+		log.Printf("Using the MCTS bot for %s bots", level)
+	}
+	return levels
+}
+
+func NewMCTSBot(playerNum int, thinkTime time.Duration, seed int64) *MCTSBot {
+	return &MCTSBot{
+		PlayerNum: playerNum,
+		ThinkTime: thinkTime,
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+type mctsNode struct {
+	parent   *mctsNode
+	column   int // move that led to this node
+	player   int // player who made that move
+	children []*mctsNode
+	untried  []int
+	visits   int
+	score    float64 // wins for player, draws count half
+	winner   int     // set when the move ended the game; -1 for a draw
+}
+
+// ChooseMove searches until the think time or iteration limit is reached
+// and returns the most visited column. ctx's deadline ends the search the
+// same way. It gives up with ctx.Err() if ctx is cancelled, for example
+// because the game ended or a player left while the bot was thinking, or
+// if the deadline passes before a single playout.
+func (b *MCTSBot) ChooseMove(ctx context.Context, game *models.Game) (int, error) {
+	pos, err := positionOf(game)
+	if err != nil {
+		return NewBuiltinBot(b.PlayerNum, b.Level).ChooseMove(ctx, game)
+	}
+
+	if pos.IsFull() {
+		return -1, ErrNoValidMove
+	}
+
+	var deadline time.Time
+	if b.ThinkTime > 0 {
+		deadline = time.Now().Add(b.ThinkTime)
+	}
+
+	limit := b.MaxIterations
+	if limit == 0 && deadline.IsZero() {
+		limit = mctsDefaultIterations
+	}
+
+	root := &mctsNode{player: 3 - b.PlayerNum, untried: b.shuffledMoves(&pos)}
+
+	for i := 0; limit == 0 || i < limit; i++ {
+		if err := ctx.Err(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && root.visits > 0 {
+				break
+			}
+			return -1, err
+		}
+		if i > 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+
+		b.iterate(root, pos)
+	}
+
+	best := root.children[0]
+	for _, child := range root.children[1:] {
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return best.column, nil
+}
+
+// iterate runs one select, expand, simulate and backpropagate cycle.
+func (b *MCTSBot) iterate(root *mctsNode, pos engine.Position) {
+	node := root
+
+	// Select
+	for len(node.untried) == 0 && len(node.children) > 0 && node.winner == 0 {
+		node = node.bestChild()
+		pos.Play(node.column, node.player)
+	}
+
+	// Expand
+	if len(node.untried) > 0 && node.winner == 0 {
+		col := node.untried[len(node.untried)-1]
+		node.untried = node.untried[:len(node.untried)-1]
+
+		player := 3 - node.player
+		child := &mctsNode{parent: node, column: col, player: player}
+		if pos.IsWinningMove(col, player) {
+			child.winner = player
+		}
+		pos.Play(col, player)
+		if child.winner == 0 && pos.IsFull() {
+			child.winner = -1
+		}
+		if child.winner == 0 {
+			child.untried = b.shuffledMoves(&pos)
+		}
+
+		node.children = append(node.children, child)
+		node = child
+	}
+
+	// Simulate
+	winner := node.winner
+	if winner == 0 {
+		winner = b.rollout(pos, 3-node.player)
+	}
+
+	// Backpropagate
+	for ; node != nil; node = node.parent {
+		node.visits++
+		switch winner {
+		case node.player:
+			node.score++
+		case -1:
+			node.score += 0.5
+		}
+	}
+}
+
+// rollout plays random moves, taking any immediate win, and returns the
+// winner or -1 for a draw.
+func (b *MCTSBot) rollout(pos engine.Position, player int) int {
+	for !pos.IsFull() {
+		for col := 0; col < pos.Columns(); col++ {
+			if pos.IsWinningMove(col, player) {
+				return player
+			}
+		}
+
+		pos.Play(b.randomColumn(&pos), player)
+		player = 3 - player
+	}
+	return -1
+}
+
+func (n *mctsNode) bestChild() *mctsNode {
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	logVisits := math.Log(float64(n.visits))
+
+	for _, child := range n.children {
+		value := child.score/float64(child.visits) +
+			mctsExploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+func (b *MCTSBot) shuffledMoves(pos *engine.Position) []int {
+	moves := make([]int, 0, pos.Columns())
+	for col := 0; col < pos.Columns(); col++ {
+		if pos.CanPlay(col) {
+			moves = append(moves, col)
+		}
+	}
+	b.rng.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+	return moves
+}
+
+func (b *MCTSBot) randomColumn(pos *engine.Position) int {
+	for {
+		col := b.rng.Intn(pos.Columns())
+		if pos.CanPlay(col) {
+			return col
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// gameAfter returns a standard game with the given columns played.
+func gameAfter(t *testing.T, columns ...int) *models.Game {
+	t.Helper()
+	rules, _ := models.RulesForVariant("")
+	game := models.NewGame(&models.Player{ID: "p1"}, rules)
+	game.Player2 = &models.Player{ID: "p2"}
+	game.State = models.GameStatePlaying
+	for i, col := range columns {
+		if _, err := MakeMove(game, col, 1+i%2); err != nil {
+			t.Fatalf("playing column %d: %v", col, err)
+		}
+	}
+	game.CurrentTurn = 1 + len(columns)%2
+	return game
+}
+
+func TestMCTSSeededSearchIsReproducible(t *testing.T) {
+	positions := [][]int{
+		{},
+		{3, 3, 2},
+		{3, 2, 4, 1, 5, 6, 6, 3},
+	}
+
+	for _, moves := range positions {
+		game := gameAfter(t, moves...)
+		playerNum := game.CurrentTurn
+
+		var chosen []int
+		for run := 0; run < 3; run++ {
+			bot := NewMCTSBot(playerNum, 0, 42)
+			bot.MaxIterations = 2000
+			col, err := bot.ChooseMove(context.Background(), game)
+			if err != nil {
+				t.Fatalf("after %v: %v", moves, err)
+			}
+			chosen = append(chosen, col)
+		}
+
+		for _, col := range chosen[1:] {
+			if col != chosen[0] {
+				t.Errorf("after %v the same seed chose columns %v", moves, chosen)
+				break
+			}
+		}
+	}
+}
+
+func TestMCTSTakesImmediateWin(t *testing.T) {
+	// Player 1 has three in a row along the bottom
+	game := gameAfter(t, 0, 0, 1, 1, 2, 6)
+
+	bot := NewMCTSBot(1, 0, 1)
+	bot.MaxIterations = 2000
+	col, err := bot.ChooseMove(context.Background(), game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col != 3 {
+		t.Errorf("chose column %d, want the winning column 3", col)
+	}
+}
+
+func TestMCTSPlaysBestMoveAtDeadline(t *testing.T) {
+	game := gameAfter(t)
+	bot := NewMCTSBot(1, time.Minute, 7)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	col, err := bot.ChooseMove(ctx, game)
+	if err != nil {
+		t.Fatalf("search cut short by its deadline failed: %v", err)
+	}
+	if !IsValidMove(game, col) {
+		t.Errorf("chose unplayable column %d", col)
+	}
+}
+
+func TestMCTSStopsWhenCancelled(t *testing.T) {
+	game := gameAfter(t)
+	bot := NewMCTSBot(1, time.Minute, 7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bot.ChooseMove(ctx, game); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
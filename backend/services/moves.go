@@ -0,0 +1,91 @@
+package services
+
+import (
+	"connect-four-backend/engine"
+	"connect-four-backend/models"
+	"errors"
+)
+
+var (
+	// The board's own errors, which MakeMove returns as well
+	ErrInvalidColumn = engine.ErrInvalidColumn
+	ErrColumnFull    = engine.ErrColumnFull
+
+	ErrStaleMove = errors.New("move was made for an earlier position")
+)
+
+// MoveRequest is a move as a client sends it. ID and Number are optional:
+// ID lets a client retry a move safely, and Number, the 1-based number the
+// move will have in the game, keeps a late retry from being played in a
+// later position.
+type MoveRequest struct {
+	Column int
+	ID     string
+	Number int
+}
+
+// SubmitMove plays a move for a player and returns the number it was given.
+// A move whose ID was played before isn't played again; its number is
+// returned, with duplicate set. A rejected move is checked afresh if it is
+// sent again.
+func (gs *GameService) SubmitMove(gameID string, playerID string, req MoveRequest) (number int, duplicate bool, err error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, exists := gs.games[gameID]
+	if !exists {
+		return 0, false, ErrGameNotFound
+	}
+
+	key := playerID + ":" + req.ID
+	if req.ID != "" {
+		if played, seen := gs.moveResults[gameID][key]; seen {
+			return played, true, nil
+		}
+	}
+
+	number, err = gs.submitMove(game, playerID, req)
+
+	// Only played moves are kept, including the one that ended the game, so
+	// a retry of a winning move whose ack was lost still gets its ack
+	if req.ID != "" && err == nil {
+		if gs.moveResults[gameID] == nil {
+			gs.moveResults[gameID] = make(map[string]int)
+		}
+		gs.moveResults[gameID][key] = number
+	}
+	return number, false, err
+}
+
+// submitMove checks and plays a move. Must be called with gamesMutex held.
+func (gs *GameService) submitMove(game *models.Game, playerID string, req MoveRequest) (int, error) {
+	playerNum := 0
+	if game.Player1.ID == playerID {
+		playerNum = 1
+	} else if game.Player2 != nil && game.Player2.ID == playerID {
+		playerNum = 2
+	}
+
+	number := len(game.Moves) + 1
+	switch {
+	case playerNum == 0:
+		return 0, ErrNotInGame
+	case game.State != models.GameStatePlaying:
+		return 0, ErrGameOver
+	case gs.paused[game.ID]:
+		return 0, ErrGamePaused
+	case req.Number != 0 && req.Number != number:
+		return 0, ErrStaleMove
+	case game.CurrentTurn != playerNum:
+		return 0, ErrNotYourTurn
+	case req.Column < 0 || req.Column >= game.Rules.Columns:
+		return 0, ErrInvalidColumn
+	case !IsValidMove(game, req.Column):
+		return 0, ErrColumnFull
+	}
+
+	if err := gs.playMove(game, playerNum, req.Column); err != nil {
+		return 0, err
+	}
+	return number, nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"database/sql"
+	"log"
+	"math"
+	"time"
+)
+
+// Glicko-2 constants. Ratings start at 1500 with the maximum deviation and
+// are stored on the Glicko scale; the algorithm works on a scale 173.7178
+// times smaller.
+const (
+	defaultRating     = 1500.0
+	defaultDeviation  = 350.0
+	defaultVolatility = 0.06
+	minDeviation      = 30.0
+
+	glickoScale = 173.7178
+	glickoTau   = 0.5 // limits how fast volatility can change
+	glickoEps   = 0.000001
+
+	// provisionalDeviation marks ratings that are still too uncertain to
+	// be trusted, which is the case for new players.
+	provisionalDeviation = 110.0
+
+	// ratingHistoryLength is how many past ratings the leaderboard shows.
+	ratingHistoryLength = 20
+)
+
+// botLevelOrder lists the bot levels from easiest to hardest.
+var botLevelOrder = []models.BotLevel{models.BotLevelEasy, models.BotLevelMedium, models.BotLevelHard, models.BotLevelPerfect}
+
+// botAnchors are the fixed ratings of the bot levels. Bots never gain or
+// lose rating, which keeps the scale from drifting.
+var botAnchors = map[models.BotLevel]float64{
+	models.BotLevelEasy:    1000,
+	models.BotLevelMedium:  1300,
+	models.BotLevelHard:    1700,
+	models.BotLevelPerfect: 2200,
+}
+
+const botAnchorDeviation = 50.0
+
+// RatingService keeps players' Glicko-2 ratings in the leaderboard table and
+// a history of past ratings alongside.
+type RatingService struct {
+	db *sql.DB
+}
+
+func NewRatingService(db *sql.DB) *RatingService {
+	return &RatingService{db: db}
+}
+
+// DefaultRating is the rating every new player starts with.
+func DefaultRating() models.Rating {
+	return models.Rating{Rating: defaultRating, Deviation: defaultDeviation, Volatility: defaultVolatility}
+}
+
+// BotRating returns the anchor rating of a bot. Bots without a level, such
+// as the MCTS bot, are anchored at the default rating.
+func BotRating(spec *models.BotSpec) models.Rating {
+	rating := defaultRating
+	if spec != nil {
+		if anchor, ok := botAnchors[spec.Level]; ok {
+			rating = anchor
+		}
+	}
+	return models.Rating{Rating: rating, Deviation: botAnchorDeviation, Volatility: defaultVolatility}
+}
+
+// BotLevelForRating picks the bot level whose anchor is closest to a
+// player's rating. Players with a provisional rating get a medium bot.
+func BotLevelForRating(r models.Rating) models.BotLevel {
+	if IsProvisional(r) {
+		return models.BotLevelMedium
+	}
+
+	best, bestGap := models.BotLevelMedium, math.Inf(1)
+	for _, level := range botLevelOrder {
+		if gap := math.Abs(botAnchors[level] - r.Rating); gap < bestGap {
+			best, bestGap = level, gap
+		}
+	}
+	return best
+}
+
+// IsProvisional reports whether a rating is still settling.
+func IsProvisional(r models.Rating) bool {
+	return r.Deviation > provisionalDeviation
+}
+
+// GetRating returns a player's current rating, or the default for players
+// who haven't finished a rated game.
+func (rs *RatingService) GetRating(username string) (models.Rating, error) {
+	r := DefaultRating()
+	err := rs.db.QueryRow(`
+		SELECT rating, rating_deviation, rating_volatility FROM leaderboard WHERE username = $1
+	`, username).Scan(&r.Rating, &r.Deviation, &r.Volatility)
+	if err == sql.ErrNoRows {
+		return DefaultRating(), nil
+	}
+	return r, err
+}
+
+// RecordGame updates the ratings of the human players in a finished rated
+// game. Both players are rated against each other's rating from before the
+// game; bots keep their anchor.
+func (rs *RatingService) RecordGame(game *models.Game) {
+	if !game.Rated || game.Player2 == nil {
+		return
+	}
+
+	players := [2]*models.Player{game.Player1, game.Player2}
+	var before [2]models.Rating
+	for i, p := range players {
+		if p.IsBot {
+			before[i] = BotRating(p.Bot)
+			continue
+		}
+
+		r, err := rs.GetRating(p.Username)
+		if err != nil {
+			log.Printf("Failed to load rating for %s: %v", p.Username, err)
+			return
+		}
+		before[i] = r
+	}
+
+	// Score for player 1; player 2 gets the rest
+	score := 0.5
+	if game.Winner != nil {
+		score = 0
+		if game.Winner.ID == game.Player1.ID {
+			score = 1
+		}
+	}
+
+	for i, p := range players {
+		if p.IsBot {
+			continue
+		}
+
+		s := score
+		if i == 1 {
+			s = 1 - score
+		}
+		after := UpdateRating(before[i], before[1-i], s)
+		if err := rs.save(p.Username, game.ID, after); err != nil {
+			log.Printf("Failed to save rating for %s: %v", p.Username, err)
+		}
+	}
+}
+
+// History returns a player's most recent ratings, oldest first.
+func (rs *RatingService) History(username string, limit int) ([]models.RatingPoint, error) {
+	rows, err := rs.db.Query(`
+		SELECT game_id, rating, deviation, recorded_at FROM (
+			SELECT id, game_id, rating, deviation, recorded_at
+			FROM rating_history
+			WHERE username = $1
+			ORDER BY id DESC
+			LIMIT $2
+		) recent
+		ORDER BY id
+	`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.RatingPoint{}
+	for rows.Next() {
+		var point models.RatingPoint
+		if err := rows.Scan(&point.GameID, &point.Rating, &point.Deviation, &point.RecordedAt); err != nil {
+			continue
+		}
+		history = append(history, point)
+	}
+
+	return history, rows.Err()
+}
+
+func (rs *RatingService) save(username, gameID string, r models.Rating) error {
+	now := time.Now()
+
+	_, err := rs.db.Exec(`
+		INSERT INTO leaderboard (username, rating, rating_deviation, rating_volatility)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username) DO UPDATE
+		SET rating = $2, rating_deviation = $3, rating_volatility = $4
+	`, username, r.Rating, r.Deviation, r.Volatility)
+	if err != nil {
+		return err
+	}
+
+	_, err = rs.db.Exec(`
+		INSERT INTO rating_history (username, game_id, rating, deviation, recorded_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, username, gameID, r.Rating, r.Deviation, now)
+	return err
+}
+
+// UpdateRating applies the Glicko-2 update for a single game, treated as a
+// rating period of its own. Score is 1 for a win, 0.5 for a draw and 0 for
+// a loss.
+func UpdateRating(player, opponent models.Rating, score float64) models.Rating {
+	return updateRating(player, []ratingResult{{opponent: opponent, score: score}})
+}
+
+// ratingResult is one game of a rating period, scored like UpdateRating.
+type ratingResult struct {
+	opponent models.Rating
+	score    float64
+}
+
+// updateRating applies the Glicko-2 update for a rating period made up of
+// the given games, following steps 2 to 8 of Glickman's paper.
+func updateRating(player models.Rating, results []ratingResult) models.Rating {
+	mu := (player.Rating - defaultRating) / glickoScale
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+
+	var vInv, improvement float64
+	for _, r := range results {
+		muJ := (r.opponent.Rating - defaultRating) / glickoScale
+		g := glickoG(r.opponent.Deviation / glickoScale)
+		e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+
+		vInv += g * g * e * (1 - e)
+		improvement += g * (r.score - e)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	sigma = newVolatility(phi, sigma, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+
+	deviation := math.Max(minDeviation, math.Min(defaultDeviation, newPhi*glickoScale))
+	return models.Rating{
+		Rating:     newMu*glickoScale + defaultRating,
+		Deviation:  deviation,
+		Volatility: sigma,
+	}
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// newVolatility solves for the new volatility with the Illinois variant of
+// regula falsi, as in step 5 of Glickman's paper.
+func newVolatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(glickoTau*glickoTau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		B = a - k*glickoTau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEps {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
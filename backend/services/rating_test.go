@@ -0,0 +1,51 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"math"
+	"testing"
+)
+
+func TestGlickmanExample(t *testing.T) {
+	// The worked example from Glickman's "Example of the Glicko-2 system":
+	// a 1500 player beats a 1400 player and loses to 1550 and 1700 players
+	// in one rating period
+	player := models.Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []ratingResult{
+		{opponent: models.Rating{Rating: 1400, Deviation: 30}, score: 1},
+		{opponent: models.Rating{Rating: 1550, Deviation: 100}, score: 0},
+		{opponent: models.Rating{Rating: 1700, Deviation: 300}, score: 0},
+	}
+
+	got := updateRating(player, results)
+	checks := []struct {
+		name      string
+		got, want float64
+		tolerance float64
+	}{
+		{"rating", got.Rating, 1464.06, 0.01},
+		{"deviation", got.Deviation, 151.52, 0.01},
+		{"volatility", got.Volatility, 0.05999, 0.00001},
+	}
+	for _, c := range checks {
+		if math.Abs(c.got-c.want) > c.tolerance {
+			t.Errorf("%s: got %.5f, want %.5f", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestUpdateRatingOrdersResults(t *testing.T) {
+	player := models.Rating{Rating: 1600, Deviation: 120, Volatility: 0.06}
+	opponent := models.Rating{Rating: 1450, Deviation: 80, Volatility: 0.06}
+
+	win, draw, loss := UpdateRating(player, opponent, 1), UpdateRating(player, opponent, 0.5), UpdateRating(player, opponent, 0)
+	if !(win.Rating > draw.Rating && draw.Rating > loss.Rating) {
+		t.Errorf("ratings after a win, draw and loss are %.1f, %.1f and %.1f", win.Rating, draw.Rating, loss.Rating)
+	}
+	if draw.Rating >= player.Rating {
+		t.Errorf("drawing a lower rated opponent raised the rating from %.1f to %.1f", player.Rating, draw.Rating)
+	}
+	if win.Deviation >= player.Deviation {
+		t.Errorf("deviation grew from %.1f to %.1f after a game", player.Deviation, win.Deviation)
+	}
+}
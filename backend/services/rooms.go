@@ -0,0 +1,168 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RoomTTL is how long a private room waits for someone to join.
+	RoomTTL = 10 * time.Minute
+
+	// Room codes avoid letters and digits that are easy to confuse when
+	// read out, like O and 0.
+	roomCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	roomCodeLength   = 6
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found or expired")
+	ErrOwnRoom      = errors.New("cannot join your own room")
+)
+
+// Room is a private game waiting for the host's friend to join with the
+// room code.
+type Room struct {
+	GameOptions
+	Code      string
+	Host      *models.Player
+	CreatedAt time.Time
+}
+
+// ExpiresAt is when the room is closed if nobody has joined.
+func (r *Room) ExpiresAt() time.Time {
+	return r.CreatedAt.Add(RoomTTL)
+}
+
+// RoomService keeps private rooms. Games started from a room skip the
+// matchmaking queue and never fall back to a bot.
+type RoomService struct {
+	rooms       map[string]*Room // code -> room
+	roomsMutex  sync.Mutex
+	gameService *GameService
+	clock       Clock
+}
+
+func NewRoomService(gameService *GameService, clock Clock) *RoomService {
+	rs := &RoomService{
+		rooms:       make(map[string]*Room),
+		gameService: gameService,
+		clock:       clock,
+	}
+
+	go rs.cleanupExpiredRooms()
+
+	return rs
+}
+
+// CreateRoom opens a room for host. A host has at most one open room, so
+// any earlier one is closed.
+func (rs *RoomService) CreateRoom(host *models.Player, opts GameOptions) (*Room, error) {
+	if !models.IsValidBestOf(opts.BestOf) {
+		return nil, ErrInvalidSeries
+	}
+
+	rs.roomsMutex.Lock()
+	defer rs.roomsMutex.Unlock()
+
+	rs.closeRoomsHostedBy(host.ID)
+
+	var code string
+	for {
+		var err error
+		code, err = newRoomCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, taken := rs.rooms[code]; !taken {
+			break
+		}
+	}
+
+	room := &Room{
+		GameOptions: opts,
+		Code:        code,
+		Host:        host,
+		CreatedAt:   rs.clock.Now(),
+	}
+	rs.rooms[code] = room
+
+	log.Printf("Player %s opened room %s (%s)", host.Username, code, opts.Rules.Variant)
+	return room, nil
+}
+
+// JoinRoom starts the room's game between the host and player, which uses
+// up the room. Codes are not case sensitive.
+func (rs *RoomService) JoinRoom(code string, player *models.Player) (*models.Game, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	rs.roomsMutex.Lock()
+	room, exists := rs.rooms[code]
+	if !exists || !rs.clock.Now().Before(room.ExpiresAt()) {
+		rs.roomsMutex.Unlock()
+		return nil, ErrRoomNotFound
+	}
+	if room.Host.ID == player.ID {
+		rs.roomsMutex.Unlock()
+		return nil, ErrOwnRoom
+	}
+	delete(rs.rooms, code)
+	rs.roomsMutex.Unlock()
+
+	game := rs.gameService.CreateGame(room.Host, room.GameOptions)
+	rs.gameService.JoinGame(game, player)
+
+	log.Printf("Player %s joined room %s hosted by %s", player.Username, code, room.Host.Username)
+	return game, nil
+}
+
+// CloseRoomsHostedBy closes the rooms of a host who left.
+func (rs *RoomService) CloseRoomsHostedBy(playerID string) {
+	rs.roomsMutex.Lock()
+	defer rs.roomsMutex.Unlock()
+	rs.closeRoomsHostedBy(playerID)
+}
+
+func (rs *RoomService) closeRoomsHostedBy(playerID string) {
+	for code, room := range rs.rooms {
+		if room.Host.ID == playerID {
+			delete(rs.rooms, code)
+		}
+	}
+}
+
+func (rs *RoomService) cleanupExpiredRooms() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rs.roomsMutex.Lock()
+		now := rs.clock.Now()
+		for code, room := range rs.rooms {
+			if !now.Before(room.ExpiresAt()) {
+				log.Printf("Room %s expired", code)
+				delete(rs.rooms, code)
+			}
+		}
+		rs.roomsMutex.Unlock()
+	}
+}
+
+func newRoomCode() (string, error) {
+	b := make([]byte, roomCodeLength)
+	max := big.NewInt(int64(len(roomCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = roomCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
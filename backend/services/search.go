@@ -0,0 +1,300 @@
+package services
+
+import (
+	"connect-four-backend/engine"
+	"connect-four-backend/models"
+)
+
+// winScore outranks any heuristic evaluation. Wins found deeper in the tree
+// score lower, so the search prefers the quickest win and the slowest loss.
+const winScore = 1000000
+
+// searchMove runs a depth-limited negamax with alpha-beta pruning and
+// returns the best column for player, or -1 if the board is full.
+func searchMove(pos engine.Position, player, depth int) int {
+	order := centerOrder(pos.Columns())
+
+	for _, col := range order {
+		if pos.IsWinningMove(col, player) {
+			return col
+		}
+	}
+
+	best, bestScore := -1, 0
+	alpha, beta := -winScore-depth-1, winScore+depth+1
+	for _, col := range order {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		next := pos
+		next.Play(col, player)
+		score := -negamax(&next, 3-player, depth-1, -beta, -alpha, order)
+
+		if best == -1 || score > bestScore {
+			best, bestScore = col, score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return best
+}
+
+func negamax(pos *engine.Position, player, depth, alpha, beta int, order []int) int {
+	if pos.IsFull() {
+		return 0
+	}
+
+	for _, col := range order {
+		if pos.IsWinningMove(col, player) {
+			return winScore + depth
+		}
+	}
+
+	if depth <= 0 {
+		return evaluate(pos, player)
+	}
+
+	for _, col := range order {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		next := *pos
+		next.Play(col, player)
+		score := -negamax(&next, 3-player, depth-1, -beta, -alpha, order)
+
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return alpha
+}
+
+// evaluate scores a position for player by looking at every window of
+// ConnectN cells. A window still open to only one side is worth the square
+// of the discs that side already has in it.
+func evaluate(pos *engine.Position, player int) int {
+	cols, rows, n := pos.Columns(), pos.Rows(), pos.ConnectN()
+	directions := [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
+	score := 0
+
+	for c := 0; c < cols; c++ {
+		for r := 0; r < rows; r++ {
+			for _, d := range directions {
+				endC, endR := c+d[0]*(n-1), r+d[1]*(n-1)
+				if endC < 0 || endC >= cols || endR < 0 || endR >= rows {
+					continue
+				}
+
+				own, opp := 0, 0
+				for i := 0; i < n; i++ {
+					switch pos.Cell(c+d[0]*i, r+d[1]*i) {
+					case 0:
+					case player:
+						own++
+					default:
+						opp++
+					}
+				}
+
+				if opp == 0 {
+					score += own * own
+				} else if own == 0 {
+					score -= opp * opp
+				}
+			}
+		}
+	}
+
+	return score
+}
+
+// sliceBoard is a scratch copy of a board too large for a bitboard, for
+// searching by playing and taking back moves in place. Row 0 is the top,
+// as in models.Game.
+type sliceBoard struct {
+	cells    [][]int
+	heights  []int // discs in each column
+	connectN int
+}
+
+func newSliceBoard(game *models.Game) *sliceBoard {
+	b := &sliceBoard{
+		cells:    make([][]int, len(game.Board)),
+		heights:  make([]int, game.Rules.Columns),
+		connectN: game.Rules.ConnectN,
+	}
+	for r, row := range game.Board {
+		b.cells[r] = append([]int(nil), row...)
+		for c, cell := range row {
+			if cell != 0 {
+				b.heights[c]++
+			}
+		}
+	}
+	return b
+}
+
+func (b *sliceBoard) canPlay(col int) bool {
+	return b.heights[col] < len(b.cells)
+}
+
+func (b *sliceBoard) isFull() bool {
+	for col := range b.heights {
+		if b.canPlay(col) {
+			return false
+		}
+	}
+	return true
+}
+
+// play drops a disc in a playable column and returns the row it landed on.
+func (b *sliceBoard) play(col, player int) int {
+	row := len(b.cells) - 1 - b.heights[col]
+	b.cells[row][col] = player
+	b.heights[col]++
+	return row
+}
+
+func (b *sliceBoard) undo(col int) {
+	b.heights[col]--
+	b.cells[len(b.cells)-1-b.heights[col]][col] = 0
+}
+
+// isWinningMove reports whether player would complete a line by playing col.
+func (b *sliceBoard) isWinningMove(col, player int) bool {
+	if !b.canPlay(col) {
+		return false
+	}
+	row := b.play(col, player)
+	defer b.undo(col)
+
+	for _, d := range [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+		count := 1
+		for _, sign := range []int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for r >= 0 && r < len(b.cells) && c >= 0 && c < len(b.heights) && b.cells[r][c] == player {
+				count++
+				r, c = r+sign*d[0], c+sign*d[1]
+			}
+		}
+		if count >= b.connectN {
+			return true
+		}
+	}
+	return false
+}
+
+// searchBoardMove is searchMove for boards too large for a bitboard. It
+// returns the best column for player, or -1 if the board is full.
+func searchBoardMove(game *models.Game, player, depth int) int {
+	b := newSliceBoard(game)
+	order := centerOrder(len(b.heights))
+
+	for _, col := range order {
+		if b.isWinningMove(col, player) {
+			return col
+		}
+	}
+
+	best, bestScore := -1, 0
+	alpha, beta := -winScore-depth-1, winScore+depth+1
+	for _, col := range order {
+		if !b.canPlay(col) {
+			continue
+		}
+
+		b.play(col, player)
+		score := -b.negamax(3-player, depth-1, -beta, -alpha, order)
+		b.undo(col)
+
+		if best == -1 || score > bestScore {
+			best, bestScore = col, score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return best
+}
+
+func (b *sliceBoard) negamax(player, depth, alpha, beta int, order []int) int {
+	if b.isFull() {
+		return 0
+	}
+
+	for _, col := range order {
+		if b.isWinningMove(col, player) {
+			return winScore + depth
+		}
+	}
+
+	if depth <= 0 {
+		return b.evaluate(player)
+	}
+
+	for _, col := range order {
+		if !b.canPlay(col) {
+			continue
+		}
+
+		b.play(col, player)
+		score := -b.negamax(3-player, depth-1, -beta, -alpha, order)
+		b.undo(col)
+
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return alpha
+}
+
+// evaluate scores the board for player the same way evaluate scores a
+// bitboard.
+func (b *sliceBoard) evaluate(player int) int {
+	rows, cols, n := len(b.cells), len(b.heights), b.connectN
+	directions := [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
+	score := 0
+
+	for c := 0; c < cols; c++ {
+		for r := 0; r < rows; r++ {
+			for _, d := range directions {
+				endC, endR := c+d[0]*(n-1), r+d[1]*(n-1)
+				if endC < 0 || endC >= cols || endR < 0 || endR >= rows {
+					continue
+				}
+
+				own, opp := 0, 0
+				for i := 0; i < n; i++ {
+					switch b.cells[r+d[1]*i][c+d[0]*i] {
+					case 0:
+					case player:
+						own++
+					default:
+						opp++
+					}
+				}
+
+				if opp == 0 {
+					score += own * own
+				} else if own == 0 {
+					score -= opp * opp
+				}
+			}
+		}
+	}
+
+	return score
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrGameInProgress     = errors.New("game is still in progress")
+	ErrInvalidSeries      = errors.New("a series must be best of 3 or 5")
+	ErrNoRematchOffer     = errors.New("no rematch has been offered")
+	ErrRematchUnavailable = errors.New("opponent is no longer available for a rematch")
+)
+
+type rematchOffer struct {
+	from   string // player ID
+	bestOf int
+}
+
+// newSeries starts a best-of-N series with the players of a game, which
+// becomes its first game. The second player is filled in when they join.
+func newSeries(game *models.Game, bestOf int) *models.Series {
+	return &models.Series{
+		ID:      uuid.New().String(),
+		BestOf:  bestOf,
+		Players: [2]*models.Player{game.Player1, game.Player2},
+		GameIDs: []string{game.ID},
+	}
+}
+
+// OfferRematch offers the opponent a rematch of a finished game, or the
+// next game of its series. A bestOf of 3 or 5 starts a new series with the
+// rematch when the game isn't already part of one that is still going.
+//
+// Bots always accept, so against a bot the new game is returned straight
+// away. If the opponent has already offered a rematch, the offer counts as
+// accepting theirs. Otherwise the game is nil and the offer waits for the
+// opponent.
+func (gs *GameService) OfferRematch(gameID string, playerID string, bestOf int) (*models.Game, error) {
+	if !models.IsValidBestOf(bestOf) {
+		return nil, ErrInvalidSeries
+	}
+
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, opponent, err := gs.rematchableGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if offer, exists := gs.rematchOffers[gameID]; exists && offer.from == opponent.ID {
+		return gs.startRematch(game, offer.bestOf), nil
+	}
+	if opponent.IsBot {
+		return gs.startRematch(game, bestOf), nil
+	}
+
+	gs.rematchOffers[gameID] = rematchOffer{from: playerID, bestOf: bestOf}
+	return nil, nil
+}
+
+// AcceptRematch accepts the opponent's rematch offer and starts the new
+// game, with the players' colours swapped.
+func (gs *GameService) AcceptRematch(gameID string, playerID string) (*models.Game, error) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, opponent, err := gs.rematchableGame(gameID, playerID)
+	if err != nil {
+		return nil, err
+	}
+
+	offer, exists := gs.rematchOffers[gameID]
+	if !exists || offer.from != opponent.ID {
+		return nil, ErrNoRematchOffer
+	}
+
+	return gs.startRematch(game, offer.bestOf), nil
+}
+
+// rematchableGame checks that a game is over and that both its players are
+// still on it rather than in a newer game, and returns the opponent.
+func (gs *GameService) rematchableGame(gameID string, playerID string) (*models.Game, *models.Player, error) {
+	game, exists := gs.games[gameID]
+	if !exists {
+		return nil, nil, ErrGameNotFound
+	}
+	if game.Player2 == nil {
+		return nil, nil, ErrNotInGame
+	}
+
+	var opponent *models.Player
+	switch playerID {
+	case game.Player1.ID:
+		opponent = game.Player2
+	case game.Player2.ID:
+		opponent = game.Player1
+	default:
+		return nil, nil, ErrNotInGame
+	}
+
+	if game.State != models.GameStateFinished {
+		return nil, nil, ErrGameInProgress
+	}
+	if gs.playerGames[opponent.ID] != gameID {
+		return nil, nil, ErrRematchUnavailable
+	}
+	if _, gone := gs.disconnected[opponent.ID]; gone {
+		return nil, nil, ErrRematchUnavailable
+	}
+
+	return game, opponent, nil
+}
+
+// startRematch creates the next game between a finished game's players
+// with colours swapped, so the other player moves first. Must be called
+// with gamesMutex held.
+func (gs *GameService) startRematch(game *models.Game, bestOf int) *models.Game {
+	delete(gs.rematchOffers, game.ID)
+
+	rematch := models.NewGame(game.Player2, game.Rules)
+	rematch.Player2 = game.Player1
+	rematch.State = models.GameStatePlaying
+	rematch.Rated = game.Rated
+	if !rematch.Rated {
+		rematch.Hints.Limit = gs.hintLimit
+	}
+	rematch.TimeControl = game.TimeControl
+	startClock(rematch, time.Now())
+	startSessions(rematch)
+
+	switch {
+	case game.Series != nil && !game.Series.Finished:
+		rematch.Series = game.Series
+		rematch.Series.GameIDs = append(rematch.Series.GameIDs, rematch.ID)
+	case bestOf > 1:
+		rematch.Series = newSeries(rematch, bestOf)
+	}
+
+	gs.games[rematch.ID] = rematch
+	gs.playerGames[rematch.Player1.ID] = rematch.ID
+	gs.playerGames[rematch.Player2.ID] = rematch.ID
+
+	log.Printf("Rematch %s: %s vs %s", rematch.ID, rematch.Player1.Username, rematch.Player2.Username)
+
+	if gs.kafkaEnabled && gs.kafka != nil {
+		gs.kafka.SendEvent(GameStartEvent{
+			Type:        "game_start",
+			GameID:      rematch.ID,
+			Player1:     rematch.Player1.Username,
+			Player2:     rematch.Player2.Username,
+			Player1Bot:  rematch.Player1.IsBot,
+			Player2Bot:  rematch.Player2.IsBot,
+			TimeControl: rematch.TimeControl.String(),
+			Timestamp:   time.Now(),
+		})
+	}
+
+	gs.publish(EventGameStarted, rematch)
+	return rematch
+}
+
+// recordSeriesGame adds a finished game's result to its series and saves
+// the series once it is decided. Must be called with gamesMutex held.
+func (gs *GameService) recordSeriesGame(game *models.Game) {
+	series := game.Series
+	if series == nil || series.Finished {
+		return
+	}
+
+	if !ScoreSeriesGame(series, game.Winner) {
+		return
+	}
+
+	if err := gs.saveSeries(series); err != nil {
+		log.Printf("Failed to save series %s: %v", series.ID, err)
+	}
+}
+
+// ScoreSeriesGame counts a game won by winner, or drawn if winner is nil,
+// and reports whether that decided the series. A series is decided when a
+// player has won more than half its games, or when all of them have been
+// played, in which case the player with more wins takes it and equal wins
+// make it a draw.
+func ScoreSeriesGame(series *models.Series, winner *models.Player) bool {
+	switch {
+	case winner == nil:
+		series.Draws++
+	case winner.ID == series.Players[0].ID:
+		series.Wins[0]++
+	default:
+		series.Wins[1]++
+	}
+
+	played := series.Wins[0] + series.Wins[1] + series.Draws
+	majority := series.Wins[0] > series.BestOf/2 || series.Wins[1] > series.BestOf/2
+	if !majority && played < series.BestOf {
+		return false
+	}
+
+	switch {
+	case series.Wins[0] > series.Wins[1]:
+		series.Winner = series.Players[0]
+	case series.Wins[1] > series.Wins[0]:
+		series.Winner = series.Players[1]
+	}
+	series.Finished = true
+	return true
+}
+
+func (gs *GameService) saveSeries(series *models.Series) error {
+	gameIDs, err := json.Marshal(series.GameIDs)
+	if err != nil {
+		return err
+	}
+
+	var winner *string
+	if series.Winner != nil {
+		winner = &series.Winner.Username
+	}
+
+	_, err = gs.db.Exec(`
+		INSERT INTO series (id, player1, player2, best_of, player1_wins, player2_wins, draws, winner, game_ids, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, series.ID, series.Players[0].Username, series.Players[1].Username, series.BestOf,
+		series.Wins[0], series.Wins[1], series.Draws, winner, string(gameIDs), time.Now())
+	return err
+}
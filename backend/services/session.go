@@ -0,0 +1,110 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session token")
+
+// SessionSecretFromEnv reads SESSION_SECRET, the key session tokens are
+// signed with. Without it a random key is used, and tokens stop working
+// when the server restarts.
+func SessionSecretFromEnv() []byte {
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Println("SESSION_SECRET not set, session tokens won't survive a restart")
+	return []byte(newNonce() + newNonce())
+}
+
+// newNonce returns a random hex string.
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// startSessions gives both players of a game a fresh session, which
+// invalidates any tokens issued for it before.
+func startSessions(game *models.Game) {
+	game.Sessions = [2]string{newNonce(), newNonce()}
+}
+
+// SessionToken returns the token a player uses to get back into a game.
+// The token names the game and player and the player's current session,
+// and is signed so it can't be forged or altered.
+func (gs *GameService) SessionToken(game *models.Game, playerNum int) string {
+	player := game.Player1
+	if playerNum == 2 {
+		player = game.Player2
+	}
+
+	claims := game.ID + ":" + player.ID + ":" + game.Sessions[playerNum-1]
+	return base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." +
+		base64.RawURLEncoding.EncodeToString(gs.sign(claims))
+}
+
+func (gs *GameService) sign(claims string) []byte {
+	mac := hmac.New(sha256.New, gs.sessionSecret)
+	mac.Write([]byte(claims))
+	return mac.Sum(nil)
+}
+
+// ResumeSession checks a session token and hands back a copy of the game
+// and the player it is for, along with a new token that replaces it.
+// Tokens are only good while the game is in progress, and each one only
+// once.
+func (gs *GameService) ResumeSession(token string) (*models.Game, *models.Player, string, error) {
+	encodedClaims, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, nil, "", ErrInvalidSession
+	}
+	claimBytes, err := base64.RawURLEncoding.DecodeString(encodedClaims)
+	if err != nil {
+		return nil, nil, "", ErrInvalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, gs.sign(string(claimBytes))) {
+		return nil, nil, "", ErrInvalidSession
+	}
+
+	parts := strings.Split(string(claimBytes), ":")
+	if len(parts) != 3 {
+		return nil, nil, "", ErrInvalidSession
+	}
+	gameID, playerID, session := parts[0], parts[1], parts[2]
+
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	game, playerNum, err := gs.activeGame(gameID, playerID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !hmac.Equal([]byte(session), []byte(game.Sessions[playerNum-1])) {
+		return nil, nil, "", ErrInvalidSession
+	}
+
+	// Rotate the session, so the token just used can't be used again
+	game.Sessions[playerNum-1] = newNonce()
+	snapshot := CloneGame(game)
+	gs.store.save(snapshot)
+
+	player := game.Player1
+	if playerNum == 2 {
+		player = game.Player2
+	}
+	return snapshot, player, gs.SessionToken(game, playerNum), nil
+}
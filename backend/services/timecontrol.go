@@ -0,0 +1,121 @@
+package services
+
+import (
+	"connect-four-backend/models"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrOutOfTime = errors.New("out of time")
+
+// startClock gives both players their full time and starts the first
+// player's turn. Untimed games get no clock.
+func startClock(game *models.Game, now time.Time) {
+	tc := game.TimeControl
+	if tc.Untimed() {
+		return
+	}
+
+	full := int64(tc.Base) * 1000
+	if tc.PerMove > 0 {
+		full = int64(tc.PerMove) * 1000
+	}
+	game.Clock = &models.GameClock{
+		RemainingMs:   [2]int64{full, full},
+		TurnStartedAt: now,
+	}
+}
+
+// TimeLeft returns both players' time left at the given moment, counting
+// the time the player to move has spent so far. The game must have a clock.
+func TimeLeft(game *models.Game, now time.Time) [2]time.Duration {
+	var left [2]time.Duration
+	for i, ms := range game.Clock.RemainingMs {
+		left[i] = time.Duration(ms) * time.Millisecond
+	}
+
+	if game.State == models.GameStatePlaying {
+		i := game.CurrentTurn - 1
+		left[i] -= now.Sub(game.Clock.TurnStartedAt)
+		if left[i] < 0 {
+			left[i] = 0
+		}
+	}
+	return left
+}
+
+// outOfTime reports whether the player to move has used up their time.
+func outOfTime(game *models.Game, now time.Time) bool {
+	if game.Clock == nil || game.State != models.GameStatePlaying {
+		return false
+	}
+	return TimeLeft(game, now)[game.CurrentTurn-1] <= 0
+}
+
+// chargeClock takes the time a player spent on their move off their clock
+// and starts the opponent's turn. The player then gains the increment, or
+// gets the full time per move back.
+func chargeClock(game *models.Game, playerNum int, now time.Time) {
+	if game.Clock == nil {
+		return
+	}
+
+	left := TimeLeft(game, now)[playerNum-1]
+	if tc := game.TimeControl; tc.PerMove > 0 {
+		left = time.Duration(tc.PerMove) * time.Second
+	} else {
+		left += time.Duration(tc.Increment) * time.Second
+	}
+
+	game.Clock.RemainingMs[playerNum-1] = left.Milliseconds()
+	game.Clock.TurnStartedAt = now
+}
+
+// endOnTime finishes a game whose player to move has run out of time. Must
+// be called with gamesMutex held.
+func (gs *GameService) endOnTime(game *models.Game, now time.Time) {
+	flagged, winner := game.Player1, game.Player2
+	if game.CurrentTurn == 2 {
+		flagged, winner = game.Player2, game.Player1
+	}
+
+	game.Clock.RemainingMs[game.CurrentTurn-1] = 0
+	game.State = models.GameStateFinished
+	game.Winner = winner
+	game.EndTime = &now
+
+	log.Printf("Game %s: %s ran out of time", game.ID, flagged.Username)
+
+	gs.saveGameResult(game, models.ReasonTimeout)
+}
+
+// scheduleFlag sets a timer to end the game when the player to move runs
+// out of time, without waiting for them to try to move, replacing the timer
+// for the previous turn. Clocks of paused games are held. Must be called
+// with gamesMutex held.
+func (gs *GameService) scheduleFlag(game *models.Game, now time.Time) {
+	if timer, ok := gs.flagTimers[game.ID]; ok {
+		timer.Stop()
+		delete(gs.flagTimers, game.ID)
+	}
+	if game.Clock == nil || game.State != models.GameStatePlaying || gs.paused[game.ID] {
+		return
+	}
+
+	gameID := game.ID
+	left := TimeLeft(game, now)[game.CurrentTurn-1]
+	gs.flagTimers[gameID] = time.AfterFunc(left, func() { gs.flag(gameID) })
+}
+
+// flag ends a game on time if its player to move is still out of time when
+// the timer fires.
+func (gs *GameService) flag(gameID string) {
+	gs.gamesMutex.Lock()
+	defer gs.gamesMutex.Unlock()
+
+	now := time.Now()
+	if game := gs.games[gameID]; game != nil && outOfTime(game, now) && !gs.paused[gameID] {
+		gs.endOnTime(game, now)
+	}
+}
@@ -0,0 +1,94 @@
+package solver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Book holds precomputed exact scores for early positions. Scores are
+// stored once per mirror pair, since a position and its reflection always
+// have the same value.
+type Book struct {
+	scores   map[uint64]int8
+	maxMoves int
+}
+
+func NewBook() *Book {
+	return &Book{scores: make(map[uint64]int8)}
+}
+
+// LoadBook reads a book in text form: one position per line as a move
+// string (see ParsePosition) followed by its score. Blank lines and lines
+// starting with # are ignored.
+func LoadBook(r io.Reader) (*Book, error) {
+	book := NewBook()
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("book line %d: expected moves and score", line)
+		}
+
+		// The empty position is written as "-"
+		moves := fields[0]
+		if moves == "-" {
+			moves = ""
+		}
+
+		pos, err := ParsePosition(moves)
+		if err != nil {
+			return nil, fmt.Errorf("book line %d: %w", line, err)
+		}
+		score, err := strconv.Atoi(fields[1])
+		if err != nil || score < MinScore-3 || score > MaxScore+3 {
+			return nil, fmt.Errorf("book line %d: invalid score %q", line, fields[1])
+		}
+
+		book.Add(pos, score)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// Add records the exact score of a position.
+func (b *Book) Add(pos Position, score int) {
+	b.scores[bookKey(&pos)] = int8(score)
+	if pos.moves > b.maxMoves {
+		b.maxMoves = pos.moves
+	}
+}
+
+// Len returns the number of positions in the book.
+func (b *Book) Len() int {
+	return len(b.scores)
+}
+
+func (b *Book) lookup(pos *Position) (int, bool) {
+	if b == nil || pos.moves > b.maxMoves {
+		return 0, false
+	}
+	score, ok := b.scores[bookKey(pos)]
+	return int(score), ok
+}
+
+func bookKey(pos *Position) uint64 {
+	key, mirrored := pos.key(), pos.mirrorKey()
+	if mirrored < key {
+		return mirrored
+	}
+	return key
+}
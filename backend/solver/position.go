@@ -0,0 +1,242 @@
+package solver
+
+import (
+	"connect-four-backend/models"
+	"errors"
+	"math/bits"
+)
+
+// The solver only handles the standard board.
+const (
+	Width  = 7
+	Height = 6
+)
+
+var (
+	ErrUnsupportedRules = errors.New("solver only supports standard 7x6 connect four")
+	ErrInvalidPosition  = errors.New("invalid position")
+	ErrInvalidMove      = errors.New("invalid move")
+	ErrGameOver         = errors.New("game is already over")
+)
+
+const (
+	bottomMask = uint64(0x40810204081) // bottom cell of each column
+	boardMask  = bottomMask * ((1 << Height) - 1)
+)
+
+// Position is a standard connect-four position seen from the player to
+// move. Each column uses Height+1 bits, bottom first, with a sentinel bit on
+// top. current holds the discs of the player to move and mask holds every
+// disc, so current+mask is a unique key for the position.
+type Position struct {
+	current uint64
+	mask    uint64
+	moves   int
+	over    bool
+}
+
+// ParsePosition builds a position from a sequence of 1-based column digits,
+// e.g. "4453" for columns 3, 3, 4, 2 in zero-based terms. It rejects
+// sequences that overfill a column or continue after a win.
+func ParsePosition(moves string) (Position, error) {
+	var p Position
+	for _, ch := range moves {
+		col := int(ch - '1')
+		if col < 0 || col >= Width {
+			return Position{}, ErrInvalidMove
+		}
+		if err := p.Play(col); err != nil {
+			return Position{}, err
+		}
+	}
+	return p, nil
+}
+
+// FromGame builds a position from a game's board. The player to move is
+// derived from the disc counts, so the game's own turn field is not trusted.
+func FromGame(game *models.Game) (Position, error) {
+	if game.Rules.Columns != Width || game.Rules.Rows != Height || game.Rules.ConnectN != 4 {
+		return Position{}, ErrUnsupportedRules
+	}
+
+	var discs [2]uint64
+	moves := 0
+	for c := 0; c < Width; c++ {
+		for r := Height - 1; r >= 0; r-- {
+			player := game.Board[Height-1-r][c]
+			if player == 0 {
+				continue
+			}
+			if player != 1 && player != 2 {
+				return Position{}, ErrInvalidPosition
+			}
+			discs[player-1] |= 1 << uint(c*(Height+1)+r)
+			moves++
+		}
+	}
+
+	// Player 1 always moves first, so it has the same number of discs as
+	// player 2 or exactly one more.
+	count1, count2 := bits.OnesCount64(discs[0]), bits.OnesCount64(discs[1])
+	if count1 != count2 && count1 != count2+1 {
+		return Position{}, ErrInvalidPosition
+	}
+
+	mask := discs[0] | discs[1]
+	// Every column must be filled from the bottom with no gaps
+	if !contiguous(mask) {
+		return Position{}, ErrInvalidPosition
+	}
+
+	toMove := moves % 2
+	p := Position{
+		current: discs[toMove],
+		mask:    mask,
+		moves:   moves,
+		over:    aligned(discs[0]) || aligned(discs[1]),
+	}
+	return p, nil
+}
+
+// contiguous reports whether every column of mask is filled from the bottom.
+func contiguous(mask uint64) bool {
+	for c := 0; c < Width; c++ {
+		col := (mask >> uint(c*(Height+1))) & ((1 << Height) - 1)
+		if col&(col+1) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Moves returns the number of discs on the board.
+func (p *Position) Moves() int { return p.moves }
+
+// IsOver reports whether the last move completed a line or filled the board.
+func (p *Position) IsOver() bool { return p.over || p.moves == Width*Height }
+
+// CanPlay reports whether a disc can be dropped in the column.
+func (p *Position) CanPlay(col int) bool {
+	return col >= 0 && col < Width && p.mask&topMaskCol(col) == 0
+}
+
+// IsWinningMove reports whether playing the column wins for the player to
+// move.
+func (p *Position) IsWinningMove(col int) bool {
+	return p.CanPlay(col) && p.winningPosition()&p.possible()&columnMask(col) != 0
+}
+
+// Play drops a disc in the column for the player to move.
+func (p *Position) Play(col int) error {
+	if p.IsOver() {
+		return ErrGameOver
+	}
+	if !p.CanPlay(col) {
+		return ErrInvalidMove
+	}
+	won := p.IsWinningMove(col)
+	p.play((p.mask + bottomMaskCol(col)) & columnMask(col))
+	p.over = won
+	return nil
+}
+
+func (p *Position) play(move uint64) {
+	p.current ^= p.mask
+	p.mask |= move
+	p.moves++
+}
+
+func (p *Position) key() uint64 {
+	return p.current + p.mask
+}
+
+// mirrorKey returns the key of the position reflected left to right, which
+// always has the same score.
+func (p *Position) mirrorKey() uint64 {
+	key := p.key()
+	var mirrored uint64
+	for c := 0; c < Width; c++ {
+		col := (key >> uint(c*(Height+1))) & ((1 << (Height + 1)) - 1)
+		mirrored |= col << uint((Width-1-c)*(Height+1))
+	}
+	return mirrored
+}
+
+func (p *Position) canWinNext() bool {
+	return p.winningPosition()&p.possible() != 0
+}
+
+// possibleNonLosingMoves returns the playable cells that don't hand the
+// opponent an immediate win, or 0 if every move loses.
+func (p *Position) possibleNonLosingMoves() uint64 {
+	possible := p.possible()
+	opponentWin := p.opponentWinningPosition()
+	forced := possible & opponentWin
+	if forced != 0 {
+		if forced&(forced-1) != 0 {
+			// Opponent has two winning cells; we can only block one
+			return 0
+		}
+		possible = forced
+	}
+	// Don't play directly below a cell the opponent wins on
+	return possible &^ (opponentWin >> 1)
+}
+
+// moveScore counts the winning cells a move creates for the player to move.
+func (p *Position) moveScore(move uint64) int {
+	return bits.OnesCount64(winningCells(p.current|move, p.mask))
+}
+
+func (p *Position) possible() uint64 {
+	return (p.mask + bottomMask) & boardMask
+}
+
+func (p *Position) winningPosition() uint64 {
+	return winningCells(p.current, p.mask)
+}
+
+func (p *Position) opponentWinningPosition() uint64 {
+	return winningCells(p.current^p.mask, p.mask)
+}
+
+// winningCells returns the empty cells that would complete a line of four
+// for the discs in position.
+func winningCells(position, mask uint64) uint64 {
+	// Vertical
+	r := (position << 1) & (position << 2) & (position << 3)
+
+	for _, shift := range [3]uint{Height + 1, Height, Height + 2} {
+		p := (position << shift) & (position << (2 * shift))
+		r |= p & (position << (3 * shift))
+		r |= p & (position >> shift)
+		p = (position >> shift) & (position >> (2 * shift))
+		r |= p & (position << shift)
+		r |= p & (position >> (3 * shift))
+	}
+
+	return r & (boardMask ^ mask)
+}
+
+// aligned reports whether position contains four discs in a row.
+func aligned(position uint64) bool {
+	for _, shift := range [4]uint{1, Height + 1, Height, Height + 2} {
+		m := position & (position >> shift)
+		if m&(m>>(2*shift)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func topMaskCol(col int) uint64 {
+	return 1 << uint(Height-1+col*(Height+1))
+}
+
+func bottomMaskCol(col int) uint64 {
+	return 1 << uint(col*(Height+1))
+}
+
+func columnMask(col int) uint64 {
+	return ((1 << Height) - 1) << uint(col*(Height+1))
+}
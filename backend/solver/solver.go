@@ -0,0 +1,352 @@
+package solver
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Scores follow the usual convention for connect four solvers: a positive
+// score means the player to move wins, and the sooner the win the higher the
+// score. A player who wins with their k-th disc scores 22-k.
+const (
+	MinScore = -(Width*Height)/2 + 3
+	MaxScore = (Width*Height+1)/2 - 3
+)
+
+// DefaultTableSize is the number of transposition table entries used when
+// New is given zero. Each entry takes 9 bytes.
+const DefaultTableSize = 1 << 21
+
+var ErrAborted = errors.New("search aborted")
+
+type Outcome string
+
+const (
+	OutcomeWin  Outcome = "win"
+	OutcomeLoss Outcome = "loss"
+	OutcomeDraw Outcome = "draw"
+)
+
+// Result is the game-theoretic value of a position for the player to move.
+type Result struct {
+	Outcome Outcome `json:"outcome"`
+	Score   int     `json:"score"`
+	Plies   int     `json:"plies"` // moves left in the game under perfect play
+}
+
+// ColumnResult is the value of playing a column, from the point of view of
+// the player making the move.
+type ColumnResult struct {
+	Column int    `json:"column"`
+	Result Result `json:"result"`
+}
+
+// Solver computes exact scores with a negamax search using alpha-beta
+// pruning, a transposition table and an optional opening book. It is safe
+// for concurrent use, but searches are serialised because they share the
+// transposition table.
+type Solver struct {
+	mu    sync.Mutex
+	table *table
+	book  *Book
+
+	ctx     context.Context
+	nodes   uint64
+	aborted bool
+}
+
+// New creates a solver whose transposition table holds tableSize entries.
+func New(tableSize int) *Solver {
+	if tableSize <= 0 {
+		tableSize = DefaultTableSize
+	}
+	return &Solver{table: newTable(tableSize)}
+}
+
+// SetBook installs an opening book. Passing nil removes it.
+func (s *Solver) SetBook(book *Book) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.book = book
+}
+
+// Solve returns the exact value of the position. Early positions without a
+// book can take a long time; cancel ctx to give up with ErrAborted.
+func (s *Solver) Solve(ctx context.Context, pos Position) (Result, error) {
+	if pos.IsOver() {
+		return Result{}, ErrGameOver
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	score, err := s.solve(ctx, pos)
+	if err != nil {
+		return Result{}, err
+	}
+	return resultFor(pos.moves, score), nil
+}
+
+// Analyze returns the value of every playable column, ordered by column.
+func (s *Solver) Analyze(ctx context.Context, pos Position) ([]ColumnResult, error) {
+	if pos.IsOver() {
+		return nil, ErrGameOver
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []ColumnResult
+	for col := 0; col < Width; col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		var score int
+		if pos.IsWinningMove(col) {
+			score = (Width*Height + 1 - pos.moves) / 2
+		} else {
+			next := pos
+			next.Play(col)
+			if next.IsOver() {
+				// The board filled up
+				score = 0
+			} else {
+				childScore, err := s.solve(ctx, next)
+				if err != nil {
+					return nil, err
+				}
+				score = -childScore
+			}
+		}
+
+		results = append(results, ColumnResult{
+			Column: col,
+			Result: resultFor(pos.moves, score),
+		})
+	}
+
+	return results, nil
+}
+
+// BestMove returns the strongest column and its value. Among equally good
+// moves the most central one is preferred.
+func (s *Solver) BestMove(ctx context.Context, pos Position) (int, Result, error) {
+	results, err := s.Analyze(ctx, pos)
+	if err != nil {
+		return -1, Result{}, err
+	}
+
+	best := -1
+	var bestResult Result
+	for _, col := range columnOrder {
+		for _, r := range results {
+			if r.Column == col && (best == -1 || r.Result.Score > bestResult.Score) {
+				best, bestResult = col, r.Result
+			}
+		}
+	}
+
+	return best, bestResult, nil
+}
+
+// resultFor converts a score for the player to move into an outcome and the
+// number of plies until the game ends.
+func resultFor(moves, score int) Result {
+	switch {
+	case score > 0:
+		// The player to move wins with their (22-score)-th disc
+		remaining := (Width*Height+2)/2 - score - moves/2
+		return Result{Outcome: OutcomeWin, Score: score, Plies: 2*remaining - 1}
+	case score < 0:
+		remaining := (Width*Height+2)/2 + score - (moves+1)/2
+		return Result{Outcome: OutcomeLoss, Score: score, Plies: 2 * remaining}
+	default:
+		return Result{Outcome: OutcomeDraw, Plies: Width*Height - moves}
+	}
+}
+
+// solve narrows the score window with null-window searches until the exact
+// score is known.
+func (s *Solver) solve(ctx context.Context, pos Position) (int, error) {
+	if pos.canWinNext() {
+		return (Width*Height + 1 - pos.moves) / 2, nil
+	}
+
+	s.ctx = ctx
+	s.aborted = false
+	defer func() { s.ctx = nil }()
+
+	min := -(Width*Height - pos.moves) / 2
+	max := (Width*Height + 1 - pos.moves) / 2
+
+	for min < max {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+
+		r := s.negamax(pos, med, med+1)
+		if s.aborted {
+			return 0, ErrAborted
+		}
+
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+
+	return min, nil
+}
+
+// negamax returns the score of a position that cannot be won on the next
+// move, within the (alpha, beta) window.
+func (s *Solver) negamax(pos Position, alpha, beta int) int {
+	s.nodes++
+	if s.nodes&0xfff == 0 && s.ctx.Err() != nil {
+		s.aborted = true
+	}
+	if s.aborted {
+		return 0
+	}
+
+	next := pos.possibleNonLosingMoves()
+	if next == 0 {
+		// Every move lets the opponent win next turn
+		return -(Width*Height - pos.moves) / 2
+	}
+
+	if pos.moves >= Width*Height-2 {
+		return 0
+	}
+
+	// We can't win next move, so the opponent can't lose before our
+	// second move from now
+	min := -(Width*Height - 2 - pos.moves) / 2
+	if alpha < min {
+		alpha = min
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	max := (Width*Height - 1 - pos.moves) / 2
+	key := pos.key()
+	if val := s.table.get(key); val != 0 {
+		if val > MaxScore-MinScore+1 {
+			// Stored as a lower bound
+			min = val + 2*MinScore - MaxScore - 2
+			if alpha < min {
+				alpha = min
+				if alpha >= beta {
+					return alpha
+				}
+			}
+		} else {
+			// Stored as an upper bound
+			max = val + MinScore - 1
+			if beta > max {
+				beta = max
+				if alpha >= beta {
+					return beta
+				}
+			}
+		}
+	}
+
+	if score, ok := s.book.lookup(&pos); ok {
+		return score
+	}
+
+	var moves moveSorter
+	for i := Width - 1; i >= 0; i-- {
+		if move := next & columnMask(columnOrder[i]); move != 0 {
+			moves.add(move, pos.moveScore(move))
+		}
+	}
+
+	for move := moves.next(); move != 0; move = moves.next() {
+		child := pos
+		child.play(move)
+		score := -s.negamax(child, -beta, -alpha)
+		if s.aborted {
+			return 0
+		}
+
+		if score >= beta {
+			s.table.put(key, score+MaxScore-2*MinScore+2)
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table.put(key, alpha-MinScore+1)
+	return alpha
+}
+
+// columnOrder explores central columns first, since they take part in more
+// lines and tend to produce earlier cutoffs.
+var columnOrder = [Width]int{3, 2, 4, 1, 5, 0, 6}
+
+// moveSorter hands out moves from the highest score to the lowest. Moves
+// with equal scores come out in reverse insertion order.
+type moveSorter struct {
+	size    int
+	entries [Width]struct {
+		move  uint64
+		score int
+	}
+}
+
+func (m *moveSorter) add(move uint64, score int) {
+	pos := m.size
+	m.size++
+	for ; pos > 0 && m.entries[pos-1].score > score; pos-- {
+		m.entries[pos] = m.entries[pos-1]
+	}
+	m.entries[pos].move = move
+	m.entries[pos].score = score
+}
+
+func (m *moveSorter) next() uint64 {
+	if m.size == 0 {
+		return 0
+	}
+	m.size--
+	return m.entries[m.size].move
+}
+
+// table is a fixed-size transposition table. Colliding entries simply
+// overwrite each other; a value of 0 means empty.
+type table struct {
+	keys   []uint64
+	values []int8
+}
+
+func newTable(size int) *table {
+	return &table{
+		keys:   make([]uint64, size),
+		values: make([]int8, size),
+	}
+}
+
+func (t *table) put(key uint64, value int) {
+	i := key % uint64(len(t.keys))
+	t.keys[i] = key
+	t.values[i] = int8(value)
+}
+
+func (t *table) get(key uint64) int {
+	i := key % uint64(len(t.keys))
+	if t.keys[i] != key {
+		return 0
+	}
+	return int(t.values[i])
+}
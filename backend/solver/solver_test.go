@@ -0,0 +1,219 @@
+package solver
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bruteForce scores a position by searching every line to the end, with
+// none of the solver's pruning, table or move ordering.
+func bruteForce(pos Position) int {
+	if pos.moves == Width*Height {
+		return 0
+	}
+	for col := 0; col < Width; col++ {
+		if pos.CanPlay(col) && pos.IsWinningMove(col) {
+			return (Width*Height + 1 - pos.moves) / 2
+		}
+	}
+
+	best := MinScore - 1
+	for col := 0; col < Width; col++ {
+		if !pos.CanPlay(col) {
+			continue
+		}
+		next := pos
+		next.Play(col)
+		if score := -bruteForce(next); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// latePositions plays random games without a winner for the given number
+// of moves, returning them as move strings. Games that can only go on with
+// a winning move are started again. Only positions that take a search to
+// settle are kept: the player to move can't win at once, and has a move
+// that doesn't lose at once.
+func latePositions(rng *rand.Rand, count, moves int) []string {
+	var positions []string
+	for len(positions) < count {
+		var pos Position
+		var seq strings.Builder
+		for pos.moves < moves {
+			var cols []int
+			for col := 0; col < Width; col++ {
+				if pos.CanPlay(col) && !pos.IsWinningMove(col) {
+					cols = append(cols, col)
+				}
+			}
+			if len(cols) == 0 {
+				break
+			}
+
+			col := cols[rng.Intn(len(cols))]
+			pos.Play(col)
+			seq.WriteByte(byte('1' + col))
+		}
+		if pos.moves == moves && !pos.canWinNext() && pos.possibleNonLosingMoves() != 0 {
+			positions = append(positions, seq.String())
+		}
+	}
+	return positions
+}
+
+func TestSolveMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := New(1 << 16)
+
+	for _, moves := range latePositions(rng, 40, 28) {
+		pos, err := ParsePosition(moves)
+		if err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+
+		want := bruteForce(pos)
+		got, err := s.Solve(context.Background(), pos)
+		if err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+		if got.Score != want {
+			t.Errorf("%s: solver scored %d, brute force %d", moves, got.Score, want)
+		}
+	}
+}
+
+func TestSolveKnownPositions(t *testing.T) {
+	tests := []struct {
+		moves string
+		want  Result
+	}{
+		// Three in a row with the fourth cell open: win on the next disc
+		{"112233", Result{Outcome: OutcomeWin, Score: 18, Plies: 1}},
+		// Open three along the bottom that can only be blocked at one end
+		{"33445", Result{Outcome: OutcomeLoss, Score: -18, Plies: 2}},
+		// An open three for the player to move: win on the disc after next
+		{"3344", Result{Outcome: OutcomeWin, Score: 18, Plies: 3}},
+	}
+
+	s := New(1 << 16)
+	for _, tt := range tests {
+		pos, err := ParsePosition(tt.moves)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.moves, err)
+		}
+		got, err := s.Solve(context.Background(), pos)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.moves, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.moves, got, tt.want)
+		}
+	}
+}
+
+func TestBestMove(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	s := New(1 << 16)
+
+	// Besides quiet positions, take the replies to them that leave a win on
+	// the spot, and a position facing two threats that can't both be blocked
+	positions := []string{"33445"}
+	for _, moves := range latePositions(rng, 40, 30) {
+		positions = append(positions, moves)
+		pos, _ := ParsePosition(moves)
+		for col := 0; col < Width; col++ {
+			next := pos
+			if next.CanPlay(col) && next.Play(col) == nil && next.canWinNext() {
+				positions = append(positions, moves+string(rune('1'+col)))
+			}
+		}
+	}
+
+	wins, losses := 0, 0
+	for _, moves := range positions {
+		pos, err := ParsePosition(moves)
+		if err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+
+		col, result, err := s.BestMove(context.Background(), pos)
+		if err != nil {
+			t.Fatalf("%s: %v", moves, err)
+		}
+
+		want := bruteForce(pos)
+		if result.Score != want {
+			t.Errorf("%s: best move scored %d, brute force %d", moves, result.Score, want)
+		}
+		if pos.canWinNext() && !pos.IsWinningMove(col) {
+			t.Errorf("%s: chose column %d over a win on the spot", moves, col)
+		}
+		next := pos
+		next.Play(col)
+		if !pos.IsWinningMove(col) && -bruteForce(next) != want {
+			t.Errorf("%s: column %d doesn't keep the best score %d", moves, col, want)
+		}
+
+		switch result.Outcome {
+		case OutcomeWin:
+			wins++
+		case OutcomeLoss:
+			losses++
+		}
+	}
+
+	if wins == 0 || losses == 0 {
+		t.Errorf("positions covered %d forced wins and %d forced losses, want some of each", wins, losses)
+	}
+}
+
+func TestBookAnswersOpening(t *testing.T) {
+	// The scores of the seven first moves, from the second player's side:
+	// only the centre wins for the first player, and the next two columns
+	// out draw
+	book, err := LoadBook(strings.NewReader(`# first moves
+1 2
+2 1
+3 0
+4 -1
+5 0
+6 1
+7 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(1 << 16)
+	s.SetBook(book)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	results, err := s.Analyze(ctx, Position{})
+	if err != nil {
+		t.Fatalf("opening wasn't answered from the book: %v", err)
+	}
+	for i, want := range []int{-2, -1, 0, 1, 0, -1, -2} {
+		if results[i].Result.Score != want {
+			t.Errorf("column %d scored %d, want %d", i, results[i].Result.Score, want)
+		}
+	}
+}
+
+func TestLoadBookRejectsBadLines(t *testing.T) {
+	for _, text := range []string{
+		"44",        // no score
+		"44 x",      // not a number
+		"44 99",     // out of range
+		"1111111 0", // overfills a column
+	} {
+		if _, err := LoadBook(strings.NewReader(text)); err == nil {
+			t.Errorf("%q was accepted", text)
+		}
+	}
+}
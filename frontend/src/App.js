@@ -15,6 +15,8 @@ function App() {
   const [showLeaderboard, setShowLeaderboard] = useState(false);
   
   const wsRef = useRef(null);
+  const sessionTokenRef = useRef(''); // proves who we are when reconnecting
+  const lastSeqRef = useRef(0); // last numbered game message seen
 
   useEffect(() => {
     return () => {
@@ -59,17 +61,24 @@ function App() {
 
   const handleMessage = (data) => {
     console.log('Received message:', data);
+    if (data.seq) {
+      lastSeqRef.current = data.seq;
+    }
 
     switch (data.type) {
       case 'game_start':
         setGameState('playing');
         setGame(data.payload.game);
         setYourPlayerId(data.payload.yourPlayerId);
+        sessionTokenRef.current = data.payload.sessionToken;
         setMessage(`Game started! You are Player ${data.payload.yourPlayerId === data.payload.game.player1.id ? '1 (Red)' : '2 (Yellow)'}`);
         break;
 
       case 'game_update':
         setGame(data.payload.game);
+        if (data.payload.sessionToken) {
+          sessionTokenRef.current = data.payload.sessionToken;
+        }
         if (data.payload.message) {
           setMessage(data.payload.message);
         }
@@ -127,7 +136,7 @@ function App() {
   };
 
   const reconnect = () => {
-    if (!game || !username) return;
+    if (!game || !sessionTokenRef.current) return;
 
     connectWebSocket();
 
@@ -138,8 +147,9 @@ function App() {
         wsRef.current.send(JSON.stringify({
           type: 'reconnect',
           payload: {
-            username: username.trim(),
-            gameId: game.id
+            gameId: game.id,
+            sessionToken: sessionTokenRef.current,
+            lastSeq: lastSeqRef.current
           }
         }));
       }
@@ -168,6 +178,8 @@ function App() {
     setGameState('idle');
     setGame(null);
     setYourPlayerId('');
+    sessionTokenRef.current = '';
+    lastSeqRef.current = 0;
     setMessage('');
     setError('');
     if (wsRef.current) {
@@ -1,10 +1,13 @@
 import React from 'react';
 import './GameBoard.css';
 
-const ROWS = 6;
-const COLUMNS = 7;
+const DEFAULT_ROWS = 6;
+const DEFAULT_COLUMNS = 7;
 
 function GameBoard({ game, onColumnClick, canPlay }) {
+  const ROWS = game.rules?.rows || DEFAULT_ROWS;
+  const COLUMNS = game.rules?.columns || DEFAULT_COLUMNS;
+
   const isWinningCell = (row, col) => {
     if (!game.winningLine) return false;
     return game.winningLine.some(([r, c]) => r === row && c === col);
@@ -59,6 +59,7 @@ function Leaderboard() {
             <tr>
               <th>Rank</th>
               <th>Player</th>
+              <th>Rating</th>
               <th>Wins</th>
               <th>Losses</th>
               <th>Draws</th>
@@ -81,6 +82,9 @@ function Leaderboard() {
                     {index > 2 && (index + 1)}
                   </td>
                   <td className="username">{entry.username}</td>
+                  <td className="rating" title={`±${Math.round(entry.deviation * 2)}`}>
+                    {Math.round(entry.rating)}{entry.provisional && '?'}
+                  </td>
                   <td className="wins">{entry.wins}</td>
                   <td className="losses">{entry.losses}</td>
                   <td className="draws">{entry.draws}</td>